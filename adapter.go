@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ysh86/ftPIC/d2xx"
+	"github.com/ysh86/ftPIC/d2xx/ftdi"
+)
+
+// runAdapter maintains the FT2232H of the programmer itself.
+func runAdapter(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "eeprom":
+			runEEPROM(args[1:])
+			return
+		case "record":
+			runRecord(args[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s adapter eeprom|record [flags]\n", os.Args[0])
+	exitStatus = exitUsage
+}
+
+// eepromDoc is the JSON form of the FT2232H EEPROM.
+type eepromDoc struct {
+	DevType        string              `json:"devType"`
+	Manufacturer   string              `json:"manufacturer"`
+	ManufacturerID string              `json:"manufacturerID"`
+	Desc           string              `json:"desc"`
+	Serial         string              `json:"serial"`
+	FT2232H        *ftdi.EEPROMFT2232H `json:"ft2232h"`
+}
+
+// runEEPROM prints the EEPROM as JSON or YAML, after the edits of -load and
+// -set, and programs it with -write.
+func runEEPROM(args []string) {
+	fs := flag.NewFlagSet("adapter eeprom", flag.ExitOnError)
+	var (
+		load   string
+		sets   setsFlag
+		write  bool
+		format string
+		ff     flashFlags
+	)
+	ff.registerAdapter(fs)
+	fs.StringVar(&load, "load", "", "take the fields from a JSON file, as printed by this command with -format json")
+	fs.Var(&sets, "set", "set a field, e.g. Desc=PIC programmer, ADriverType=VCP or ALDriveCurrent=8 (repeatable)")
+	fs.BoolVar(&write, "write", false, "program the EEPROM; without it, the result is only printed")
+	fs.StringVar(&format, "format", "json", "output format: json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s adapter eeprom [-load FILE] [-set FIELD=VALUE]... [-format json|yaml] [-write]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || (format != "json" && format != "yaml") {
+		fs.Usage()
+		exitStatus = exitUsage
+		return
+	}
+
+	adapter, err := ff.openAdapter()
+	if err != nil {
+		fail("d2xx", err)
+		return
+	}
+	defer adapter.Close()
+
+	ee, err := adapter.ReadEEPROM()
+	if err != nil {
+		fail("eeprom", err)
+		return
+	}
+	devType, _, _, _ := adapter.Info()
+	doc := &eepromDoc{
+		DevType:        devType.String(),
+		Manufacturer:   ee.Manufacturer,
+		ManufacturerID: ee.ManufacturerID,
+		Desc:           ee.Desc,
+		Serial:         ee.Serial,
+		FT2232H:        ee.AsFT2232H(),
+	}
+	if doc.FT2232H == nil {
+		fail("eeprom", errors.New("unexpected EEPROM size"))
+		return
+	}
+
+	// the fields of the FT2232H struct are decoded in place, into ee.Raw
+	if load != "" {
+		data, err := os.ReadFile(load)
+		if err == nil {
+			err = json.Unmarshal(data, doc)
+		}
+		if err == nil && doc.FT2232H == nil {
+			err = fmt.Errorf("%s: ft2232h is missing", load)
+		}
+		if err != nil {
+			fail("eeprom", err)
+			return
+		}
+	}
+	for _, s := range sets {
+		name, value, _ := strings.Cut(s, "=")
+		if err := doc.set(name, value); err != nil {
+			fail("eeprom", usageError(err.Error()))
+			return
+		}
+	}
+	ee.Manufacturer = doc.Manufacturer
+	ee.ManufacturerID = doc.ManufacturerID
+	ee.Desc = doc.Desc
+	ee.Serial = doc.Serial
+
+	if format == "yaml" {
+		err = doc.writeYAML(os.Stdout)
+	} else {
+		var out []byte
+		out, err = json.MarshalIndent(doc, "", "  ")
+		if err == nil {
+			fmt.Println(string(out))
+		}
+	}
+	if err != nil {
+		fail("eeprom", err)
+		return
+	}
+
+	if write {
+		if err := doc.validate(); err != nil {
+			fail("eeprom", usageError(err.Error()))
+			return
+		}
+		if err := adapter.ProgramEEPROM(ee); err != nil {
+			fail("eeprom", err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "eeprom: programmed, replug the programmer to apply")
+	}
+}
+
+// set sets the field named name, case insensitive: a string, or a field of
+// the FT2232H struct.
+func (d *eepromDoc) set(name, value string) error {
+	for _, s := range []struct {
+		name string
+		p    *string
+	}{
+		{"Manufacturer", &d.Manufacturer},
+		{"ManufacturerID", &d.ManufacturerID},
+		{"Desc", &d.Desc},
+		{"Serial", &d.Serial},
+	} {
+		if strings.EqualFold(name, s.name) {
+			*s.p = value
+			return nil
+		}
+	}
+
+	v := reflect.ValueOf(d.FT2232H).Elem()
+	f, ok := v.Type().FieldByNameFunc(func(n string) bool {
+		return strings.EqualFold(n, name)
+	})
+	if !ok || f.Anonymous || strings.HasPrefix(f.Name, "Unused") {
+		return fmt.Errorf("unknown EEPROM field: %s", name)
+	}
+
+	if strings.HasSuffix(f.Name, "DriverType") {
+		switch strings.ToUpper(value) {
+		case "D2XX":
+			value = "0"
+		case "VCP":
+			value = "1"
+		}
+	}
+	n, err := strconv.ParseUint(value, 0, f.Type.Bits())
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", f.Name, value)
+	}
+	v.FieldByIndex(f.Index).SetUint(n)
+	return nil
+}
+
+// validate checks the fields of the FT2232H struct which the FT2232H
+// restricts, however they were set.
+func (d *eepromDoc) validate() error {
+	v := reflect.ValueOf(d.FT2232H).Elem()
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if f.Anonymous {
+			continue
+		}
+		n := v.FieldByIndex(f.Index).Uint()
+		switch {
+		case strings.HasSuffix(f.Name, "DriveCurrent"):
+			if n != 4 && n != 8 && n != 12 && n != 16 {
+				return fmt.Errorf("invalid %s: %d mA, 4, 8, 12 or 16 expected", f.Name, n)
+			}
+		case strings.HasSuffix(f.Name, "DriverType"):
+			if n > 1 {
+				return fmt.Errorf("invalid %s: %d, D2XX (0) or VCP (1) expected", f.Name, n)
+			}
+		case f.Name == "MaxPower":
+			if n == 0 || n > 500 {
+				return fmt.Errorf("invalid %s: %d mA, 1 to 500 expected", f.Name, n)
+			}
+		}
+	}
+	return nil
+}
+
+// writeYAML prints the document as YAML, with the keys of the JSON form in the
+// same order.
+func (d *eepromDoc) writeYAML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if err := writeYAMLFields(bw, reflect.ValueOf(d).Elem(), ""); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeYAMLFields(w io.Writer, v reflect.Value, indent string) error {
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if f.Anonymous || !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag != "" {
+			name = tag
+		}
+		fv := v.FieldByIndex(f.Index)
+		switch {
+		case fv.Kind() == reflect.String:
+			// Go escapes are valid in double-quoted YAML scalars
+			fmt.Fprintf(w, "%s%s: %s\n", indent, name, strconv.Quote(fv.String()))
+		case fv.CanUint():
+			fmt.Fprintf(w, "%s%s: %d\n", indent, name, fv.Uint())
+		case fv.Kind() == reflect.Pointer && fv.IsNil():
+			fmt.Fprintf(w, "%s%s: null\n", indent, name)
+		case fv.Kind() == reflect.Pointer && fv.Elem().Kind() == reflect.Struct:
+			fmt.Fprintf(w, "%s%s:\n", indent, name)
+			if err := writeYAMLFields(w, fv.Elem(), indent+"  "); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("yaml: unsupported field %s of type %s", name, f.Type)
+		}
+	}
+	return nil
+}
+
+// runRecord prints the adapter record of the EEPROM user area, and with
+// -write, updates it with the fields given.
+func runRecord(args []string) {
+	fs := flag.NewFlagSet("adapter record", flag.ExitOnError)
+	var (
+		model  string
+		pins   string
+		clock  hzFlag
+		margin float64
+		write  bool
+		clear  bool
+		ff     flashFlags
+	)
+	ff.registerAdapter(fs)
+	fs.StringVar(&model, "model", "", "adapter model")
+	fs.StringVar(&pins, "pins", "", "pin map of the adapter")
+	fs.Var(&clock, "clock", "default ICSPCLK frequency, e.g. 500k or 5M")
+	fs.Float64Var(&margin, "margin", 0, "calibrated margin of the programming delays, e.g. 1.5")
+	fs.BoolVar(&write, "write", false, "write the record, updated with the fields given")
+	fs.BoolVar(&clear, "clear", false, "erase the record")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s adapter record [-model MODEL] [-pins PINS] [-clock HZ] [-margin X] [-write | -clear]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || (write && clear) {
+		fs.Usage()
+		exitStatus = exitUsage
+		return
+	}
+	if pins != "" && d2xx.PinMapByName(pins) == nil {
+		fail("record", usageError("unknown pin map: "+pins))
+		return
+	}
+
+	adapter, err := ff.openAdapter()
+	if err != nil {
+		fail("d2xx", err)
+		return
+	}
+	defer adapter.Close()
+
+	if clear {
+		if err := adapter.WriteUA(nil); err != nil {
+			fail("record", err)
+			return
+		}
+		fmt.Println("record: cleared")
+		return
+	}
+
+	rec, err := adapter.ReadRecord()
+	if err != nil {
+		if !write && !errors.Is(err, d2xx.ErrNoAdapterRecord) {
+			fail("record", err)
+			return
+		}
+		// none yet, or replaced
+		rec = &d2xx.AdapterRecord{}
+	}
+	if !write {
+		if *rec == (d2xx.AdapterRecord{}) {
+			fmt.Println("record: none")
+		} else {
+			fmt.Printf("record: %s\n", rec)
+		}
+		return
+	}
+
+	if model != "" {
+		rec.Model = model
+	}
+	if pins != "" {
+		rec.Pins = pins
+	}
+	if clock != 0 {
+		rec.ClockHz = int(clock)
+	}
+	if margin != 0 {
+		rec.Margin = margin
+	}
+	if err := adapter.WriteRecord(rec); err != nil {
+		fail("record", err)
+		return
+	}
+	fmt.Printf("record: %s written\n", rec)
+}
+
+// setsFlag collects FIELD=VALUE assignments.
+type setsFlag []string
+
+func (s *setsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setsFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("FIELD=VALUE expected: %s", v)
+	}
+	*s = append(*s, v)
+	return nil
+}
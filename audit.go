@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// openAuditLog opens the audit log for appending, creating it if needed.
+func openAuditLog(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+}
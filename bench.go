@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// runBench measures how fast the PFM of the target is read back, and with
+// -write, programmed.
+//
+// Every pass reads the whole PFM; passes which differ from the first one are
+// reported since they point to a lost or misaligned batch. -write then erases
+// the PFM and programs it back with what was read, once.
+//
+// With -sweep, the passes are repeated for each combination of USB settings
+// and the fastest one is printed as flags. The data of every combination must
+// match a reference read with the default settings, or it is left out.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var (
+		passes    int
+		chunk     int
+		sweep     bool
+		transfers string
+		latencies string
+		write     bool
+		ff        flashFlags
+	)
+	ff.register(fs)
+	fs.IntVar(&passes, "n", 3, "number of passes")
+	fs.IntVar(&chunk, "chunk", 0, "bytes per Read call, odd sizes allowed (default: the whole PFM at once)")
+	fs.BoolVar(&sweep, "sweep", false, "measure every combination of -sweep-transfer, -sweep-latency and -usb-flow on and off")
+	fs.StringVar(&transfers, "sweep-transfer", "512,4096,16384,65536", "USB transfer sizes measured by -sweep")
+	fs.StringVar(&latencies, "sweep-latency", "1,2,4,16", "latency timers in ms measured by -sweep")
+	fs.BoolVar(&write, "write", false, "also measure programming: the PFM is erased and programmed back with what was read")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if passes < 1 {
+		fail("bench", usageError("-n must be at least 1"))
+		return
+	}
+
+	if !sweep {
+		flash, err := ff.open()
+		if err != nil {
+			fail("d2xx", err)
+			return
+		}
+		defer ff.close(flash)
+
+		size := flash.Device.PFMSize
+		if chunk <= 0 || chunk > size {
+			chunk = size
+		}
+		fmt.Printf("%s: reading %d bytes, %d bytes per Read, %d passes\n", flash.Device.Name, size, chunk, passes)
+		avg, data, err := benchRead(flash, chunk, passes, true)
+		if err != nil {
+			fail("bench", err)
+			return
+		}
+		fmt.Printf("average: %.3f sec, %.1f KiB/s\n", avg.Seconds(), kibPerSec(size, avg))
+		if write {
+			elapsed, err := benchWrite(flash, data)
+			if err != nil {
+				fail("bench", err)
+				return
+			}
+			fmt.Printf("write: %.3f sec, %.1f KiB/s\n", elapsed.Seconds(), kibPerSec(size, elapsed))
+		}
+		return
+	}
+
+	sizes, err := parseInts(transfers)
+	if err != nil {
+		fail("bench", usageError("-sweep-transfer: "+err.Error()))
+		return
+	}
+	delays, err := parseInts(latencies)
+	if err != nil {
+		fail("bench", usageError("-sweep-latency: "+err.Error()))
+		return
+	}
+
+	// what every combination must read
+	ref, err := benchUSB(ff, d2xx.DefaultUSBParams, chunk, passes, false)
+	if err != nil {
+		fail("bench", fmt.Errorf("reference read: %w", err))
+		return
+	}
+
+	var best d2xx.USBParams
+	var bestRate float64
+	fmt.Printf("%8s %8s %8s %10s", "transfer", "latency", "flow", "KiB/s")
+	if write {
+		fmt.Printf(" %10s", "write")
+	}
+	fmt.Println()
+	for _, size := range sizes {
+		for _, delay := range delays {
+			for _, flow := range []bool{true, false} {
+				usb := ff.usb
+				usb.TransferSize, usb.LatencyMS, usb.FlowControl = size, delay, flow
+				fmt.Printf("%8d %6dms %8t ", size, delay, flow)
+
+				r, err := benchUSB(ff, usb, chunk, passes, write)
+				if err == nil && !bytes.Equal(r.data, ref.data) {
+					err = errors.New("differs from the reference read")
+				}
+				if err != nil {
+					fmt.Printf("%10s (%v)\n", "-", err)
+					continue
+				}
+				fmt.Printf("%10.1f", r.read)
+				if write {
+					fmt.Printf(" %10.1f", r.write)
+				}
+				fmt.Println()
+				if r.read > bestRate {
+					best, bestRate = usb, r.read
+				}
+			}
+		}
+	}
+	if bestRate == 0 {
+		fail("bench", errors.New("no combination could read the target"))
+		return
+	}
+	fmt.Printf("best: %.1f KiB/s with -usb-transfer %d -usb-latency %d -usb-flow=%t\n",
+		bestRate, best.TransferSize, best.LatencyMS, best.FlowControl)
+}
+
+// benchResult are the rates in KiB/s measured with a combination of USB
+// settings, and the data read.
+type benchResult struct {
+	read  float64
+	write float64 // 0 unless measured
+	data  []byte
+}
+
+// benchUSB opens the target with usb and measures its average read rate, and
+// its write rate if write is set.
+func benchUSB(ff flashFlags, usb d2xx.USBParams, chunk, passes int, write bool) (*benchResult, error) {
+	ff.usb = usb
+	flash, err := ff.open()
+	if err != nil {
+		return nil, err
+	}
+	defer ff.close(flash)
+	size := flash.Device.PFMSize
+	avg, data, err := benchRead(flash, chunk, passes, false)
+	if err != nil {
+		return nil, err
+	}
+	r := &benchResult{read: kibPerSec(size, avg), data: data}
+	if write {
+		elapsed, err := benchWrite(flash, data)
+		if err != nil {
+			return nil, err
+		}
+		r.write = kibPerSec(size, elapsed)
+	}
+	return r, nil
+}
+
+// benchRead reads the whole PFM passes times, chunk bytes per Read, and
+// returns the average duration of a pass and the data read.
+func benchRead(flash *d2xx.Flash, chunk, passes int, verbose bool) (time.Duration, []byte, error) {
+	size := flash.Device.PFMSize
+	if chunk <= 0 || chunk > size {
+		chunk = size
+	}
+
+	var first []byte
+	var total time.Duration
+	for pass := 1; pass <= passes; pass++ {
+		_, err := flash.Seek(0, io.SeekStart)
+		if err != nil {
+			return 0, nil, err
+		}
+		data := make([]byte, size)
+		start := time.Now()
+		for pos := 0; pos < size; {
+			n, err := flash.Read(data[pos:min(pos+chunk, size)])
+			if err != nil {
+				return 0, nil, fmt.Errorf("read at %06x: %w", pos, err)
+			}
+			pos += n
+		}
+		elapsed := time.Since(start)
+		total += elapsed
+
+		if verbose {
+			fmt.Printf("pass %d: %.3f sec, %.1f KiB/s\n", pass, elapsed.Seconds(), kibPerSec(size, elapsed))
+		}
+		if first == nil {
+			first = data
+		} else if !bytes.Equal(first, data) {
+			return 0, nil, fmt.Errorf("pass %d differs from pass 1", pass)
+		}
+	}
+	return total / time.Duration(passes), first, nil
+}
+
+// benchWrite erases the PFM, programs data and returns how long it took. The
+// PFM is verified afterward.
+func benchWrite(flash *d2xx.Flash, data []byte) (time.Duration, error) {
+	start := time.Now()
+	err := flash.BulkErase(d2xx.REGION_FLASH)
+	if err == nil {
+		err = flash.WritePFM(data)
+	}
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	return elapsed, flash.Verify(d2xx.REGION_FLASH, data, nil)
+}
+
+func kibPerSec(size int, d time.Duration) float64 {
+	return float64(size) / 1024 / d.Seconds()
+}
+
+// parseInts parses a comma separated list of integers.
+func parseInts(s string) ([]int, error) {
+	var values []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", f)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	"github.com/ysh86/ftPIC/d2xx"
+	"github.com/ysh86/ftPIC/firmware"
+)
+
+// checksums are the MPLAB checksum and the digests of each region.
+type checksums struct {
+	Checksum string         `json:"checksum"`
+	Regions  []regionDigest `json:"regions"`
+}
+
+type regionDigest struct {
+	Region string `json:"region"`
+	CRC32  string `json:"crc32"`
+	SHA256 string `json:"sha256"`
+}
+
+// computeChecksums digests every region of the device as returned by read.
+func computeChecksums(dev *d2xx.Device, read func(mr d2xx.MemoryRegion) ([]byte, error)) (*checksums, error) {
+	c := &checksums{}
+	var pfm, cfg []byte
+	for _, mr := range dev.Regions() {
+		data, err := read(mr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mr.Name, err)
+		}
+		switch mr.Region {
+		case d2xx.REGION_FLASH:
+			pfm = data
+		case d2xx.REGION_CONFIGURATION:
+			cfg = data
+		}
+		sum := sha256.Sum256(data)
+		c.Regions = append(c.Regions, regionDigest{
+			Region: mr.Name,
+			CRC32:  fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	c.Checksum = fmt.Sprintf("%04X", dev.Checksum(pfm, cfg))
+	return c, nil
+}
+
+// imageChecksums digests the image as programmed: missing data is erased.
+func imageChecksums(dev *d2xx.Device, img *firmware.Image) *checksums {
+	c, _ := computeChecksums(dev, func(mr d2xx.MemoryRegion) ([]byte, error) {
+		return img.Slice(mr.Start, mr.End, 0xff), nil
+	})
+	return c
+}
+
+// deviceChecksums digests the target memory read back.
+func deviceChecksums(flash *d2xx.Flash) (*checksums, error) {
+	return computeChecksums(flash.Device, func(mr d2xx.MemoryRegion) ([]byte, error) {
+		return flash.ReadRegion(mr.Region)
+	})
+}
+
+func printChecksums(title string, c *checksums) {
+	fmt.Fprintf(stdout, "Checksum (%s): %s\n", title, c.Checksum)
+	for _, r := range c.Regions {
+		fmt.Fprintf(stdout, " %-13s crc32: %s, sha256: %s\n", r.Region, r.CRC32, r.SHA256)
+	}
+}
+
+// runChecksum computes the checksums of image files without touching the
+// hardware.
+func runChecksum(args []string) {
+	fs := flag.NewFlagSet("checksum", flag.ExitOnError)
+	var (
+		format  string
+		base    uint64
+		devName string
+	)
+	fs.StringVar(&format, "f", "", "image file format: ihex, srec, bin or elf (default: guessed from the extension)")
+	fs.Uint64Var(&base, "base", 0, "load address of raw binary images")
+	fs.StringVar(&devName, "d", "PIC18F47Q43", "device of the memory map")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s checksum [flags] IMAGE...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exitStatus = exitUsage
+		return
+	}
+
+	dev := d2xx.DeviceByName(devName)
+	if dev == nil {
+		fail("checksum", usageError("unknown device: "+devName))
+		return
+	}
+	img, err := loadImage(fs.Args(), &options{format: format, base: base})
+	if err != nil {
+		fail("checksum", err)
+		return
+	}
+	err = checkImage(img, dev)
+	if err != nil {
+		fail("checksum", err)
+		return
+	}
+	printChecksums("image", imageChecksums(dev, img))
+}
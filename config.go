@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// runConfig computes the configuration bytes from FIELD=VALUE settings.
+//
+// The settings are applied on top of the target's current configuration, or
+// on top of the erased state (all 0xff) when a device name is given.
+func runConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	var (
+		devName string
+		program bool
+		force   bool
+		audit   string
+		ff      flashFlags
+	)
+	ff.register(fs)
+	fs.StringVar(&devName, "d", "", "compute offline for the named device, e.g. PIC18F47Q43")
+	fs.BoolVar(&program, "w", false, "program the computed bytes to the target")
+	fs.BoolVar(&force, "force", false, "allow values which may lock out this programmer (LVP=OFF, CP/WRTx=ON, MCLRE=INTMCLR)")
+	fs.StringVar(&audit, "audit", "", "append a JSON-lines record of the write to the file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s config [flags] [FIELD=VALUE ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if devName != "" {
+		if program {
+			fail("config", usageError("-d and -w are exclusive"))
+			return
+		}
+		dev := d2xx.DeviceByName(devName)
+		if dev == nil {
+			fail("config", usageError("unknown device: "+devName))
+			return
+		}
+		cfg := make([]byte, dev.ConfigSize)
+		for i := range cfg {
+			cfg[i] = 0xff
+		}
+		err := dev.EncodeConfig(cfg, fs.Args())
+		if err != nil {
+			fail("config", err)
+			return
+		}
+		printConfig(dev, cfg)
+		return
+	}
+
+	flash, err := ff.open()
+	if err != nil {
+		fail("d2xx", err)
+		return
+	}
+	defer ff.close(flash)
+	if audit != "" {
+		w, err := openAuditLog(audit)
+		if err != nil {
+			fail("audit", err)
+			return
+		}
+		defer w.Close()
+		flash.SetAuditLog(w)
+	}
+
+	cfg := make([]byte, len(flash.Configuration))
+	copy(cfg, flash.Configuration[:])
+	err = flash.Device.EncodeConfig(cfg, fs.Args())
+	if err != nil {
+		fail("config", err)
+		return
+	}
+	printConfig(flash.Device, cfg)
+
+	if program {
+		err := flash.WriteConfig(cfg, force)
+		var dangerous *d2xx.DangerousConfigError
+		if errors.As(err, &dangerous) {
+			fail("config", err)
+			fmt.Fprintln(os.Stderr, "config: nothing was written; use -force if this is really intended")
+		} else if err != nil {
+			fail("config", err)
+		} else {
+			fmt.Fprintln(stdout, "config: done")
+		}
+	}
+}
+
+func printConfig(dev *d2xx.Device, cfg []byte) {
+	fmt.Fprintf(stdout, "Configuration Bytes (%d Bytes)\n", len(cfg))
+	for i := 0; i < len(cfg); i++ {
+		fmt.Fprintf(stdout, " %02x", cfg[i])
+	}
+	fmt.Fprintln(stdout)
+	for _, s := range dev.DecodeConfig(cfg) {
+		fmt.Fprintf(stdout, " CONFIG%-2d %-9s = %-15s %s\n", s.Field.Reg+1, s.Field.Name, s.Symbol(), s.Desc())
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ysh86/ftPIC/d2xx"
+	"github.com/ysh86/ftPIC/firmware"
+)
+
+var regionNames = map[string]d2xx.Region{
+	"pfm":    d2xx.REGION_FLASH,
+	"eeprom": d2xx.REGION_DATA_EEPROM,
+	"userid": d2xx.REGION_USER_ID,
+	"config": d2xx.REGION_CONFIGURATION,
+}
+
+// runConvert converts an image file into another format without touching
+// the hardware.
+func runConvert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	var (
+		from      string
+		to        string
+		base      uint64
+		devName   string
+		region    string
+		extract   rangesFlag
+		fill      uint
+		recordLen int
+	)
+	fs.StringVar(&from, "from", "", "input format: ihex, srec, bin or elf (default: guessed from the extension)")
+	fs.StringVar(&to, "to", "", "output format: ihex, srec or bin (default: guessed from the extension)")
+	fs.Uint64Var(&base, "base", 0, "load address of a raw binary input")
+	fs.StringVar(&devName, "d", "PIC18F47Q43", "device of the memory map used by -region")
+	fs.StringVar(&region, "region", "", "extract a single region: pfm, eeprom, userid or config")
+	fs.Var(&extract, "range", "extract an address range, e.g. 0x0000-0x1fff")
+	fs.UintVar(&fill, "fill", 0xff, "fill byte for missing data in raw binary output")
+	fs.IntVar(&recordLen, "reclen", 16, "data bytes per record of ihex and srec output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s convert [flags] INPUT... OUTPUT\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 || len(extract) > 1 || fill > 0xff {
+		fs.Usage()
+		exitStatus = exitUsage
+		return
+	}
+	inFiles, outFile := fs.Args()[:fs.NArg()-1], fs.Arg(fs.NArg()-1)
+
+	images := make([]*firmware.Image, len(inFiles))
+	for i, inFile := range inFiles {
+		img, err := firmware.Load(inFile, from, uint32(base))
+		if err != nil {
+			fail("convert", err)
+			return
+		}
+		images[i] = img
+	}
+	img, err := firmware.Merge(inFiles, images)
+	if err != nil {
+		fail("convert", err)
+		return
+	}
+
+	// the start address of raw binary output; 0 unless extracting
+	start := uint32(0)
+	if region != "" {
+		dev := d2xx.DeviceByName(devName)
+		if dev == nil {
+			fail("convert", usageError("unknown device: "+devName))
+			return
+		}
+		r, ok := regionNames[strings.ToLower(region)]
+		if !ok {
+			fail("convert", usageError("unknown region: "+region))
+			return
+		}
+		mr, _ := dev.Region(r)
+		img = img.Extract(mr.Start, mr.End)
+		start = mr.Start
+	}
+	if len(extract) == 1 {
+		img = img.Extract(extract[0].Start, extract[0].End)
+		start = max(start, extract[0].Start)
+	}
+
+	opts := &firmware.WriteOptions{
+		RecordLen: recordLen,
+		Start:     start,
+		Fill:      byte(fill),
+	}
+	err = firmware.Save(outFile, to, img, opts)
+	if err != nil {
+		fail("convert", err)
+		return
+	}
+	printSegments(img)
+}
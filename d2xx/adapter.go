@@ -0,0 +1,218 @@
+package d2xx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/ysh86/ftPIC/d2xx/ftdi"
+)
+
+// openFT2232H opens channel A of the first FT2232H, or opts.Simulator.
+func openFT2232H(opts *Options) (*device, error) {
+	const (
+		SUPPORTED = ftdi.FT2232H
+	)
+
+	opener := d2xxOpen
+	if opts.Simulator != nil {
+		opener = opts.Simulator.open
+	} else {
+		num, err := numDevices()
+		if err != nil {
+			return nil, err
+		}
+		if num < 2 {
+			return nil, fmt.Errorf("%w: numDevices: %d", ErrDeviceNotFound, num)
+		}
+	}
+	if opts.Trace != nil {
+		opener = tracingOpener(opener, opts.Trace, opts.TraceBytes)
+	}
+
+	// open 1st dev only
+	dev, err := openDev(opener, 0)
+	if err != nil {
+		return nil, err
+	}
+	if dev.t != SUPPORTED {
+		dev.closeDev()
+		return nil, fmt.Errorf("%w: device is not %s, but %s", ErrDeviceNotFound, SUPPORTED, dev.t)
+	}
+	return dev, nil
+}
+
+// Adapter is the FT2232H of the programmer, opened without talking to a
+// target, to maintain its EEPROM.
+type Adapter struct {
+	dev *device
+}
+
+// OpenAdapter opens the programmer. Only the Trace and Simulator options are
+// used; a nil *Options selects the defaults.
+func OpenAdapter(opts *Options) (*Adapter, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	dev, err := openFT2232H(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Adapter{dev: dev}, nil
+}
+
+func (a *Adapter) Close() error {
+	return a.dev.closeDev()
+}
+
+// Info returns the device type, the USB vendor and product IDs and the
+// serial number of the programmer.
+func (a *Adapter) Info() (ftdi.DevType, uint16, uint16, string) {
+	return a.dev.t, a.dev.venID, a.dev.devID, a.dev.serial
+}
+
+// ReadEEPROM reads the EEPROM. A blank EEPROM reads as a valid default
+// content.
+func (a *Adapter) ReadEEPROM() (*ftdi.EEPROM, error) {
+	ee := &ftdi.EEPROM{}
+	if err := a.dev.readEEPROM(ee); err != nil {
+		return nil, err
+	}
+	return ee, nil
+}
+
+// ProgramEEPROM programs the EEPROM, once ee passed the sanity checks: the
+// string lengths, and the device type and USB IDs, which must be unchanged.
+func (a *Adapter) ProgramEEPROM(ee *ftdi.EEPROM) error {
+	return a.dev.programEEPROM(ee)
+}
+
+// ReadUA reads the EEPROM user area; it is empty on a blank EEPROM.
+func (a *Adapter) ReadUA() ([]byte, error) {
+	return a.dev.readUA()
+}
+
+// WriteUA writes the EEPROM user area, padded with zeros.
+func (a *Adapter) WriteUA(ua []byte) error {
+	return a.dev.writeUA(ua)
+}
+
+// AdapterRecord describes the programmer board. It is stored in the EEPROM
+// user area, where OpenFlash finds it to configure itself.
+type AdapterRecord struct {
+	Model   string  // free form, e.g. "ICSP-2232 rev B"
+	Pins    string  // PinMap name, "" for the default
+	ClockHz int     // ICSPCLK frequency, 0 for the default
+	Margin  float64 // calibrated Timing.Margin, 0 for the device's
+}
+
+// The record is, little endian:
+//
+//	0   "FP"
+//	2   version
+//	3   n, length of the fields
+//	4   Model and Pins, each a length byte and the string, ClockHz in 4 bytes
+//	    and Margin in hundredths in 2 bytes
+//	4+n CRC-32 (IEEE) of the bytes above
+//
+// Fields are only appended, so that older readers skip them; the version
+// changes when the layout isn't compatible anymore.
+const (
+	adapterMagic   = "FP"
+	adapterVersion = 1
+)
+
+// ErrNoAdapterRecord is returned when the user area holds no AdapterRecord.
+var ErrNoAdapterRecord = errors.New("no adapter record")
+
+func (r *AdapterRecord) MarshalBinary() ([]byte, error) {
+	if len(r.Model) > 255 || len(r.Pins) > 255 {
+		return nil, errors.New("adapter record: string too long")
+	}
+	if r.ClockHz < 0 || r.Margin < 0 || r.Margin*100 > 0xffff {
+		return nil, errors.New("adapter record: value out of range")
+	}
+	b := []byte(adapterMagic)
+	b = append(b, adapterVersion, 0)
+	b = append(b, byte(len(r.Model)))
+	b = append(b, r.Model...)
+	b = append(b, byte(len(r.Pins)))
+	b = append(b, r.Pins...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(r.ClockHz))
+	b = binary.LittleEndian.AppendUint16(b, uint16(math.Round(r.Margin*100)))
+	if len(b)-4 > 255 {
+		return nil, errors.New("adapter record: too long")
+	}
+	b[3] = byte(len(b) - 4)
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b)), nil
+}
+
+// UnmarshalBinary decodes a record at the start of b, typically the whole
+// user area.
+func (r *AdapterRecord) UnmarshalBinary(b []byte) error {
+	if len(b) < 4 || string(b[:2]) != adapterMagic {
+		return ErrNoAdapterRecord
+	}
+	if b[2] != adapterVersion {
+		return fmt.Errorf("adapter record: unsupported version %d", b[2])
+	}
+	n := 4 + int(b[3])
+	if len(b) < n+4 || binary.LittleEndian.Uint32(b[n:]) != crc32.ChecksumIEEE(b[:n]) {
+		return errors.New("adapter record: bad CRC")
+	}
+
+	fields := b[4:n]
+	str := func() (string, error) {
+		if len(fields) < 1 || len(fields) < 1+int(fields[0]) {
+			return "", shortData(len(fields), 1)
+		}
+		s := string(fields[1 : 1+fields[0]])
+		fields = fields[1+fields[0]:]
+		return s, nil
+	}
+	var err error
+	if r.Model, err = str(); err != nil {
+		return fmt.Errorf("adapter record: %w", err)
+	}
+	if r.Pins, err = str(); err != nil {
+		return fmt.Errorf("adapter record: %w", err)
+	}
+	if len(fields) < 6 {
+		return fmt.Errorf("adapter record: %w", shortData(len(fields), 6))
+	}
+	r.ClockHz = int(binary.LittleEndian.Uint32(fields))
+	r.Margin = float64(binary.LittleEndian.Uint16(fields[4:])) / 100
+	return nil
+}
+
+func (r *AdapterRecord) String() string {
+	return fmt.Sprintf("%s (pins=%s clock=%dHz margin=%g)", r.Model, r.Pins, r.ClockHz, r.Margin)
+}
+
+// ReadRecord reads the AdapterRecord of the user area.
+func (a *Adapter) ReadRecord() (*AdapterRecord, error) {
+	return a.dev.readRecord()
+}
+
+// WriteRecord writes r to the user area, replacing its content.
+func (a *Adapter) WriteRecord(r *AdapterRecord) error {
+	b, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return a.dev.writeUA(b)
+}
+
+func (d *device) readRecord() (*AdapterRecord, error) {
+	ua, err := d.readUA()
+	if err != nil {
+		return nil, err
+	}
+	r := &AdapterRecord{}
+	if err := r.UnmarshalBinary(ua); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
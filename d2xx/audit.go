@@ -0,0 +1,72 @@
+package d2xx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// AuditRecord is one line of the audit log, appended for every erase, write
+// and verify performed through a Flash.
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Operation   string    `json:"op"`
+	Programmer  string    `json:"programmer"`
+	DeviceID    uint16    `json:"deviceID"`
+	RevisionID  uint16    `json:"revisionID"`
+	ImageSHA256 string    `json:"imageSHA256,omitempty"`
+	Regions     []string  `json:"regions"`
+	Duration    float64   `json:"durationSec"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// SetAuditLog makes f append an AuditRecord as a JSON line to w after each
+// erase, write and verify. A nil w disables the log.
+func (f *Flash) SetAuditLog(w io.Writer) {
+	f.auditLog = w
+}
+
+// audit starts an audited operation on regions; data is the image being
+// written or verified, if any. The returned function completes the record
+// with the final error and appends it to the log. A failure to append the
+// record is reported through err unless the operation already failed.
+//
+//	defer f.audit("write", REGION_FLASH, data)(&err)
+func (f *Flash) audit(op string, regions Region, data []byte) func(err *error) {
+	if f.auditLog == nil {
+		return func(*error) {}
+	}
+
+	start := time.Now()
+	rec := &AuditRecord{
+		Time:       start.UTC(),
+		Operation:  op,
+		Programmer: f.serial,
+		DeviceID:   f.DeviceID,
+		RevisionID: f.RevisionID,
+		Regions:    regions.names(),
+	}
+	if data != nil {
+		sum := sha256.Sum256(data)
+		rec.ImageSHA256 = hex.EncodeToString(sum[:])
+	}
+
+	return func(err *error) {
+		rec.Duration = time.Since(start).Seconds()
+		rec.Result = "ok"
+		if *err != nil {
+			rec.Result = "error"
+			rec.Error = (*err).Error()
+		}
+		line, e := json.Marshal(rec)
+		if e == nil {
+			_, e = f.auditLog.Write(append(line, '\n'))
+		}
+		if e != nil && *err == nil {
+			*err = e
+		}
+	}
+}
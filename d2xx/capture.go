@@ -0,0 +1,207 @@
+package d2xx
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CaptureRecord is one line of a capture: a USB transfer to or from the
+// FT2232H, as seen by device.write and device.read.
+type CaptureRecord struct {
+	Time float64 `json:"t"`              // [sec] since the device was opened
+	Op   string  `json:"op"`             // "open", "write" or "read"
+	Pins string  `json:"pins,omitempty"` // pin map, "open" only
+	Data string  `json:"data,omitempty"` // hex
+}
+
+// Bytes returns the decoded Data.
+func (r *CaptureRecord) Bytes() ([]byte, error) {
+	return hex.DecodeString(r.Data)
+}
+
+// recorder appends the transfers of a device to a capture as JSON lines.
+type recorder struct {
+	enc   *json.Encoder
+	start time.Time
+	err   error // first error, reported by Flash.Close
+}
+
+func newRecorder(w io.Writer, pins *PinMap) *recorder {
+	r := &recorder{enc: json.NewEncoder(w), start: time.Now()}
+	r.add(&CaptureRecord{Op: "open", Pins: pins.Name})
+	return r
+}
+
+func (r *recorder) add(rec *CaptureRecord) {
+	if r.err != nil {
+		return
+	}
+	rec.Time = time.Since(r.start).Seconds()
+	r.err = r.enc.Encode(rec)
+}
+
+func (r *recorder) transfer(op string, b []byte) {
+	if len(b) > 0 {
+		r.add(&CaptureRecord{Op: op, Data: hex.EncodeToString(b)})
+	}
+}
+
+// ReadCapture reads a capture written with Options.Record.
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		var rec CaptureRecord
+		err := json.Unmarshal(s.Bytes(), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", line, err)
+		}
+		if _, err := rec.Bytes(); err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, s.Err()
+}
+
+// StreamError is returned when the bytes of two sessions differ.
+type StreamError struct {
+	Op     string // "write" or "read" stream
+	Offset int    // in the stream
+	Line   int    // record of the capture holding Offset
+	Got    int    // byte, or -1 when the stream ended
+	Want   int
+}
+
+func (e *StreamError) Error() string {
+	byteOrEnd := func(b int) string {
+		if b < 0 {
+			return "end"
+		}
+		return fmt.Sprintf("%02x", b)
+	}
+	return fmt.Sprintf("%s stream differs at byte %d (line %d): %s, expected %s",
+		e.Op, e.Offset, e.Line, byteOrEnd(e.Got), byteOrEnd(e.Want))
+}
+
+// stream is the concatenation of the transfers of one direction.
+type stream struct {
+	data  []byte
+	lines []int // capture line of each byte
+}
+
+func (s *stream) add(b []byte, line int) {
+	s.data = append(s.data, b...)
+	for range b {
+		s.lines = append(s.lines, line)
+	}
+}
+
+// compare returns the first difference of got and want from offset on, or
+// nil if the shorter is a prefix of the longer.
+func compare(op string, got, want *stream, offset int) *StreamError {
+	for i := offset; i < min(len(got.data), len(want.data)); i++ {
+		if got.data[i] != want.data[i] {
+			return &StreamError{Op: op, Offset: i, Line: want.lines[i], Got: int(got.data[i]), Want: int(want.data[i])}
+		}
+	}
+	return nil
+}
+
+func lengthError(op string, got, want *stream) error {
+	n := min(len(got.data), len(want.data))
+	if len(got.data) == len(want.data) {
+		return nil
+	}
+	e := &StreamError{Op: op, Offset: n, Got: -1, Want: -1}
+	if n < len(want.data) {
+		e.Want = int(want.data[n])
+		e.Line = want.lines[n]
+	} else {
+		e.Got = int(got.data[n])
+		if len(want.lines) > 0 {
+			e.Line = want.lines[len(want.lines)-1]
+		}
+	}
+	return e
+}
+
+// Replay sends the writes of a capture to sim, wired as recorded, and
+// compares what it answers with the reads of the capture. The target memory
+// of sim is first seeded with what the capture read before programming it,
+// so that sessions with any target replay.
+func Replay(records []CaptureRecord, sim *Simulator) error {
+	if err := sim.seed(records); err != nil {
+		return err
+	}
+
+	var got, want stream
+	checked := 0
+	for i, rec := range records {
+		line := i + 1
+		data, err := rec.Bytes()
+		if err != nil {
+			return fmt.Errorf("capture line %d: %w", line, err)
+		}
+		switch rec.Op {
+		case "open":
+			sim.pins = PinMapByName(rec.Pins)
+			if sim.pins == nil {
+				return fmt.Errorf("capture line %d: unknown pin map: %s", line, rec.Pins)
+			}
+		case "write":
+			sim.d2xxWrite(data)
+			got.add(sim.out, line)
+			sim.out = nil
+		case "read":
+			want.add(data, line)
+		default:
+			return fmt.Errorf("capture line %d: unknown op: %s", line, rec.Op)
+		}
+		if e := compare("read", &got, &want, checked); e != nil {
+			return e
+		}
+		checked = min(len(got.data), len(want.data))
+	}
+	return lengthError("read", &got, &want)
+}
+
+// CompareCaptures compares the bytes written and read in two captures,
+// ignoring how they were split into transfers. The lines refer to b.
+func CompareCaptures(a, b []CaptureRecord) error {
+	streams := func(records []CaptureRecord) (map[string]*stream, error) {
+		m := map[string]*stream{"write": {}, "read": {}}
+		for i, rec := range records {
+			if s, ok := m[rec.Op]; ok {
+				data, err := rec.Bytes()
+				if err != nil {
+					return nil, fmt.Errorf("capture line %d: %w", i+1, err)
+				}
+				s.add(data, i+1)
+			}
+		}
+		return m, nil
+	}
+	sa, err := streams(a)
+	if err != nil {
+		return err
+	}
+	sb, err := streams(b)
+	if err != nil {
+		return err
+	}
+	for _, op := range []string{"write", "read"} {
+		if e := compare(op, sa[op], sb[op], 0); e != nil {
+			return e
+		}
+		if err := lengthError(op, sa[op], sb[op]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
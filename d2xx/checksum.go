@@ -0,0 +1,16 @@
+package d2xx
+
+// Checksum returns the MPLAB X/IPE compatible checksum of an unprotected
+// device: the 16-bit sum of all the PFM bytes, erased ones included, plus the
+// implemented bits of the configuration bytes.
+func (d *Device) Checksum(pfm, cfg []byte) uint16 {
+	sum := uint16(0)
+	for _, b := range pfm {
+		sum += uint16(b)
+	}
+	mask := d.ConfigMask()
+	for i, b := range cfg {
+		sum += uint16(b & mask[i])
+	}
+	return sum
+}
@@ -0,0 +1,307 @@
+package d2xx
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// ConfigField is a named bit field in the configuration bytes.
+type ConfigField struct {
+	Name   string
+	Reg    int  // 0: CONFIG1, 1: CONFIG2, ...
+	Mask   byte // bits of the field in place
+	Desc   string
+	Values []ConfigValue
+}
+
+// ConfigValue is a symbolic value of a ConfigField.
+type ConfigValue struct {
+	Name  string
+	Value byte // right aligned
+	Desc  string
+
+	// Hazard explains why programming this value may lock out this
+	// programmer. Empty if the value is safe.
+	Hazard string
+}
+
+// ConfigSetting is the value of a field decoded from the configuration bytes.
+type ConfigSetting struct {
+	Field *ConfigField
+	Value byte // right aligned
+}
+
+func (f *ConfigField) shift() int {
+	return bits.TrailingZeros8(f.Mask)
+}
+
+func (f *ConfigField) get(cfg []byte) byte {
+	return (cfg[f.Reg] & f.Mask) >> f.shift()
+}
+
+func (f *ConfigField) set(cfg []byte, v byte) {
+	cfg[f.Reg] = (cfg[f.Reg] &^ f.Mask) | ((v << f.shift()) & f.Mask)
+}
+
+// lookup returns the symbolic value of v, or nil.
+func (f *ConfigField) lookup(v byte) *ConfigValue {
+	for i := range f.Values {
+		if f.Values[i].Value == v {
+			return &f.Values[i]
+		}
+	}
+	return nil
+}
+
+// parse accepts either a symbolic name or a number.
+func (f *ConfigField) parse(s string) (byte, error) {
+	for _, v := range f.Values {
+		if strings.EqualFold(v.Name, s) {
+			return v.Value, nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil || byte(n) > f.Mask>>f.shift() {
+		return 0, fmt.Errorf("invalid value for %s: %q", f.Name, s)
+	}
+	return byte(n), nil
+}
+
+// Symbol returns the symbolic name of the value, or its number.
+func (s ConfigSetting) Symbol() string {
+	if v := s.Field.lookup(s.Value); v != nil {
+		return v.Name
+	}
+	return fmt.Sprintf("0x%x", s.Value)
+}
+
+// Desc returns the description of the value, if any.
+func (s ConfigSetting) Desc() string {
+	if v := s.Field.lookup(s.Value); v != nil {
+		return v.Desc
+	}
+	return ""
+}
+
+func (s ConfigSetting) String() string {
+	return s.Field.Name + "=" + s.Symbol()
+}
+
+// ConfigField returns the field named name, or nil.
+func (d *Device) ConfigField(name string) *ConfigField {
+	for i := range d.Config {
+		if strings.EqualFold(d.Config[i].Name, name) {
+			return &d.Config[i]
+		}
+	}
+	return nil
+}
+
+// DecodeConfig decodes the configuration bytes into named fields.
+func (d *Device) DecodeConfig(cfg []byte) []ConfigSetting {
+	var settings []ConfigSetting
+	for i := range d.Config {
+		f := &d.Config[i]
+		if f.Reg >= len(cfg) {
+			continue
+		}
+		settings = append(settings, ConfigSetting{Field: f, Value: f.get(cfg)})
+	}
+	return settings
+}
+
+// ConfigMask returns the implemented bits of each configuration byte.
+func (d *Device) ConfigMask() []byte {
+	mask := make([]byte, d.ConfigSize)
+	for _, f := range d.Config {
+		mask[f.Reg] |= f.Mask
+	}
+	return mask
+}
+
+// EncodeConfig applies "FIELD=VALUE" settings to the configuration bytes in
+// place. Bits not covered by the settings are left untouched.
+func (d *Device) EncodeConfig(cfg []byte, settings []string) error {
+	if len(cfg) != d.ConfigSize {
+		return fmt.Errorf("configuration must be %d bytes", d.ConfigSize)
+	}
+	for _, s := range settings {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("invalid setting: %q", s)
+		}
+		f := d.ConfigField(strings.TrimSpace(name))
+		if f == nil {
+			return fmt.Errorf("unknown field for %s: %q", d.Name, name)
+		}
+		v, err := f.parse(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		f.set(cfg, v)
+	}
+	return nil
+}
+
+// ConfigHazard is a configuration value that may lock out this programmer.
+type ConfigHazard struct {
+	Setting ConfigSetting
+	Reason  string
+}
+
+func (h ConfigHazard) String() string {
+	return h.Setting.String() + ": " + h.Reason
+}
+
+// DangerousConfigError is returned when programming configuration bytes with
+// hazards without explicitly allowing them.
+type DangerousConfigError struct {
+	Hazards []ConfigHazard
+}
+
+func (e *DangerousConfigError) Error() string {
+	s := "refusing to program dangerous configuration:"
+	for _, h := range e.Hazards {
+		s += "\n  " + h.String()
+	}
+	return s
+}
+
+func (e *DangerousConfigError) Is(target error) bool {
+	return target == ErrDangerousConfig
+}
+
+// CheckConfig returns the values in cfg that may lock out this programmer.
+func (d *Device) CheckConfig(cfg []byte) []ConfigHazard {
+	var hazards []ConfigHazard
+	for _, s := range d.DecodeConfig(cfg) {
+		if v := s.Field.lookup(s.Value); v != nil && v.Hazard != "" {
+			hazards = append(hazards, ConfigHazard{Setting: s, Reason: v.Hazard})
+		}
+	}
+	return hazards
+}
+
+func onOff(on, off byte) []ConfigValue {
+	return []ConfigValue{
+		{Name: "ON", Value: on, Desc: "enabled"},
+		{Name: "OFF", Value: off, Desc: "disabled"},
+	}
+}
+
+func writeProtect(what string) []ConfigValue {
+	return []ConfigValue{
+		{Name: "ON", Value: 0, Desc: "write protected",
+			Hazard: what + " becomes write protected; it can no longer be programmed until a bulk erase of the configuration clears the protection"},
+		{Name: "OFF", Value: 1, Desc: "not write protected"},
+	}
+}
+
+// configQ43 is the configuration bytes layout of the PIC18F-Q43 family as
+// described in the data sheet's configuration register summary.
+var configQ43 = []ConfigField{
+	// CONFIG1
+	{Name: "FEXTOSC", Reg: 0, Mask: 0b0000_0111, Desc: "External Oscillator Selection", Values: []ConfigValue{
+		{Name: "ECH", Value: 0b111, Desc: "EC (external clock) above 8 MHz"},
+		{Name: "ECM", Value: 0b110, Desc: "EC (external clock) for 500 kHz to 8 MHz"},
+		{Name: "ECL", Value: 0b101, Desc: "EC (external clock) below 500 kHz"},
+		{Name: "OFF", Value: 0b100, Desc: "Oscillator not enabled"},
+		{Name: "HS", Value: 0b010, Desc: "HS (crystal oscillator) above 4 MHz"},
+		{Name: "XT", Value: 0b001, Desc: "XT (crystal oscillator) below 4 MHz"},
+		{Name: "LP", Value: 0b000, Desc: "LP (crystal oscillator) optimized for 32.768 kHz"},
+	}},
+	{Name: "RSTOSC", Reg: 0, Mask: 0b0111_0000, Desc: "Reset Oscillator Selection", Values: []ConfigValue{
+		{Name: "EXTOSC", Value: 0b111, Desc: "EXTOSC operating per FEXTOSC bits"},
+		{Name: "HFINTOSC_1MHZ", Value: 0b110, Desc: "HFINTOSC with HFFRQ = 4 MHz and CDIV = 4:1"},
+		{Name: "LFINTOSC", Value: 0b101, Desc: "LFINTOSC"},
+		{Name: "SOSC", Value: 0b100, Desc: "SOSC"},
+		{Name: "EXTOSC_4PLL", Value: 0b010, Desc: "EXTOSC with 4x PLL"},
+		{Name: "HFINTOSC_64MHZ", Value: 0b000, Desc: "HFINTOSC with HFFRQ = 64 MHz and CDIV = 1:1"},
+	}},
+	// CONFIG2
+	{Name: "CLKOUTEN", Reg: 1, Mask: 0b0000_0001, Desc: "Clock Out Enable", Values: onOff(0, 1)},
+	{Name: "PR1WAY", Reg: 1, Mask: 0b0000_0010, Desc: "PRLOCKED One-Way Set Enable", Values: onOff(1, 0)},
+	{Name: "CSWEN", Reg: 1, Mask: 0b0000_1000, Desc: "Clock Switch Enable", Values: onOff(1, 0)},
+	{Name: "FCMEN", Reg: 1, Mask: 0b0010_0000, Desc: "Fail-Safe Clock Monitor Enable", Values: onOff(1, 0)},
+	{Name: "FCMENP", Reg: 1, Mask: 0b0100_0000, Desc: "Fail-Safe Clock Monitor Enable - Primary XTAL", Values: onOff(1, 0)},
+	{Name: "FCMENS", Reg: 1, Mask: 0b1000_0000, Desc: "Fail-Safe Clock Monitor Enable - Secondary XTAL", Values: onOff(1, 0)},
+	// CONFIG3
+	{Name: "MCLRE", Reg: 2, Mask: 0b0000_0001, Desc: "Master Clear (MCLR) Enable", Values: []ConfigValue{
+		{Name: "EXTMCLR", Value: 1, Desc: "MCLR pin is MCLR"},
+		{Name: "INTMCLR", Value: 0, Desc: "MCLR pin is a port defined function",
+			Hazard: "/MCLR becomes a port pin; programming mode entry then relies on LVP alone, and the target can no longer be held in reset from the programmer"},
+	}},
+	{Name: "PWRTS", Reg: 2, Mask: 0b0000_0110, Desc: "Power-up Timer Selection", Values: []ConfigValue{
+		{Name: "PWRT_OFF", Value: 0b11, Desc: "PWRT is disabled"},
+		{Name: "PWRT_64", Value: 0b10, Desc: "PWRT set at 64 ms"},
+		{Name: "PWRT_16", Value: 0b01, Desc: "PWRT set at 16 ms"},
+		{Name: "PWRT_1", Value: 0b00, Desc: "PWRT set at 1 ms"},
+	}},
+	{Name: "MVECEN", Reg: 2, Mask: 0b0000_1000, Desc: "Multi-vector Enable", Values: onOff(1, 0)},
+	{Name: "IVT1WAY", Reg: 2, Mask: 0b0001_0000, Desc: "IVTLOCK One-Way Set Enable", Values: onOff(1, 0)},
+	{Name: "LPBOREN", Reg: 2, Mask: 0b0010_0000, Desc: "Low Power BOR Enable", Values: onOff(0, 1)},
+	{Name: "BOREN", Reg: 2, Mask: 0b1100_0000, Desc: "Brown-out Reset Enable", Values: []ConfigValue{
+		{Name: "SBORDIS", Value: 0b11, Desc: "Brown-out Reset enabled, SBOREN bit is ignored"},
+		{Name: "NOSLP", Value: 0b10, Desc: "Brown-out Reset enabled while running, disabled in Sleep"},
+		{Name: "ON", Value: 0b01, Desc: "Brown-out Reset enabled according to SBOREN"},
+		{Name: "OFF", Value: 0b00, Desc: "Brown-out Reset disabled"},
+	}},
+	// CONFIG4
+	{Name: "BORV", Reg: 3, Mask: 0b0000_0011, Desc: "Brown-out Reset Voltage Selection", Values: []ConfigValue{
+		{Name: "VBOR_1P9", Value: 0b11, Desc: "Brown-out Reset Voltage (VBOR) set to 1.9V"},
+		{Name: "VBOR_2P45", Value: 0b10, Desc: "Brown-out Reset Voltage (VBOR) set to 2.45V"},
+		{Name: "VBOR_2P7", Value: 0b01, Desc: "Brown-out Reset Voltage (VBOR) set to 2.7V"},
+		{Name: "VBOR_2P85", Value: 0b00, Desc: "Brown-out Reset Voltage (VBOR) set to 2.85V"},
+	}},
+	{Name: "ZCD", Reg: 3, Mask: 0b0000_0100, Desc: "ZCD Disable", Values: []ConfigValue{
+		{Name: "OFF", Value: 1, Desc: "ZCD module is disabled; enabled by setting the ZCDSEN bit"},
+		{Name: "ON", Value: 0, Desc: "ZCD module is always enabled"},
+	}},
+	{Name: "PPS1WAY", Reg: 3, Mask: 0b0000_1000, Desc: "PPSLOCK One-Way Set Enable", Values: onOff(1, 0)},
+	{Name: "STVREN", Reg: 3, Mask: 0b0001_0000, Desc: "Stack Full/Underflow Reset Enable", Values: onOff(1, 0)},
+	{Name: "LVP", Reg: 3, Mask: 0b0010_0000, Desc: "Low Voltage Programming Enable", Values: []ConfigValue{
+		{Name: "ON", Value: 1, Desc: "enabled"},
+		{Name: "OFF", Value: 0, Desc: "disabled",
+			Hazard: "low-voltage programming is disabled; this programmer enters programming mode with the \"MCHP\" key only, so the target can no longer be accessed without a high-voltage (VPP) programmer"},
+	}},
+	{Name: "XINST", Reg: 3, Mask: 0b1000_0000, Desc: "Extended Instruction Set Enable", Values: onOff(0, 1)},
+	// CONFIG5
+	{Name: "WDTCPS", Reg: 4, Mask: 0b0001_1111, Desc: "WDT Period Select", Values: []ConfigValue{
+		{Name: "WDTCPS_31", Value: 0b1_1111, Desc: "Divider ratio 1:65536; software control of WDTPS"},
+	}},
+	{Name: "WDTE", Reg: 4, Mask: 0b0110_0000, Desc: "WDT Operating Mode", Values: []ConfigValue{
+		{Name: "ON", Value: 0b11, Desc: "WDT enabled regardless of Sleep; SWDTEN is ignored"},
+		{Name: "NSLP", Value: 0b10, Desc: "WDT enabled while Sleep = 0, suspended when Sleep = 1; SWDTEN ignored"},
+		{Name: "SWDTEN", Value: 0b01, Desc: "WDT enabled/disabled by SWDTEN bit"},
+		{Name: "OFF", Value: 0b00, Desc: "WDT disabled, SWDTEN is ignored"},
+	}},
+	// CONFIG6
+	{Name: "WDTCWS", Reg: 5, Mask: 0b0000_0111, Desc: "WDT Window Select", Values: []ConfigValue{
+		{Name: "WDTCWS_7", Value: 0b111, Desc: "window always open (100%); software control; keyed access not required"},
+	}},
+	{Name: "WDTCCS", Reg: 5, Mask: 0b0011_1000, Desc: "WDT Input Clock Selector", Values: []ConfigValue{
+		{Name: "SC", Value: 0b111, Desc: "Software Control"},
+		{Name: "SOSC", Value: 0b010, Desc: "WDT reference clock is SOSC"},
+		{Name: "MFINTOSC", Value: 0b001, Desc: "WDT reference clock is the 31.25 kHz MFINTOSC"},
+		{Name: "LFINTOSC", Value: 0b000, Desc: "WDT reference clock is the 31.0 kHz LFINTOSC"},
+	}},
+	// CONFIG7
+	{Name: "BBSIZE", Reg: 6, Mask: 0b0000_0111, Desc: "Boot Block Size Selection"},
+	{Name: "BBEN", Reg: 6, Mask: 0b0000_1000, Desc: "Boot Block Enable", Values: onOff(0, 1)},
+	{Name: "SAFEN", Reg: 6, Mask: 0b0001_0000, Desc: "Storage Area Flash Enable", Values: onOff(0, 1)},
+	// CONFIG8
+	{Name: "WRTB", Reg: 7, Mask: 0b0000_0010, Desc: "Boot Block Write Protection", Values: writeProtect("the boot block")},
+	{Name: "WRTC", Reg: 7, Mask: 0b0000_0100, Desc: "Configuration Register Write Protection", Values: writeProtect("the configuration bytes")},
+	{Name: "WRTD", Reg: 7, Mask: 0b0000_1000, Desc: "Data EEPROM Write Protection", Values: writeProtect("the data EEPROM")},
+	{Name: "WRTSAF", Reg: 7, Mask: 0b0001_0000, Desc: "SAF Write Protection", Values: writeProtect("the storage area flash")},
+	{Name: "WRTAPP", Reg: 7, Mask: 0b1000_0000, Desc: "Application Block Write Protection", Values: writeProtect("the application block")},
+	// CONFIG9
+	{Name: "CP", Reg: 8, Mask: 0b0000_0001, Desc: "PFM and Data EEPROM Code Protection", Values: []ConfigValue{
+		{Name: "ON", Value: 0, Desc: "enabled",
+			Hazard: "code protection is enabled; the PFM and data EEPROM can no longer be read nor verified, and only a bulk erase of everything clears it"},
+		{Name: "OFF", Value: 1, Desc: "disabled"},
+	}},
+	// CONFIG10: reserved
+}
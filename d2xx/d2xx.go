@@ -28,7 +28,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/ysh86/ftPIC/d2xx/ftdi"
@@ -57,7 +56,7 @@ func openDev(opener func(i int) (d2xxHandle, int), i int) (*device, error) {
 	if e != 0 {
 		return d, toErr("Open", e)
 	}
-	if d.t, d.venID, d.devID, e = h.d2xxGetDeviceInfo(); e != 0 {
+	if d.t, d.venID, d.devID, d.serial, e = h.d2xxGetDeviceInfo(); e != 0 {
 		return d, toErr("GetDeviceInfo", e)
 	}
 	return d, nil
@@ -71,10 +70,15 @@ func openDev(opener func(i int) (d2xxHandle, int), i int) (*device, error) {
 //
 // The content of the struct is immutable after initialization.
 type device struct {
-	h     d2xxHandle
-	t     ftdi.DevType
-	venID uint16
-	devID uint16
+	h      d2xxHandle
+	t      ftdi.DevType
+	venID  uint16
+	devID  uint16
+	serial string
+	rec    *recorder // captures the transfers when set
+
+	// readTimeout is how long readAll waits for the next bytes.
+	readTimeout time.Duration
 }
 
 func (d *device) closeDev() error {
@@ -82,36 +86,76 @@ func (d *device) closeDev() error {
 	return toErr("Close", d.h.d2xxClose())
 }
 
+// USBParams are the driver settings of the USB link to the FT2232H.
+type USBParams struct {
+	// TransferSize is the size of the USB IN requests, a multiple of 64
+	// from 64 to 65536 bytes.
+	TransferSize int
+	// Timeout is the read and write timeout of the driver.
+	Timeout time.Duration
+	// LatencyMS is how long the FT2232H holds back a partial packet, 1 to
+	// 255 ms.
+	LatencyMS int
+	// FlowControl turns RTS/CTS flow control on.
+	FlowControl bool
+}
+
+// DefaultUSBParams favor a short latency over fewer USB packets. The timeouts
+// are long, so that they are very visible.
+var DefaultUSBParams = USBParams{
+	TransferSize: 65536,
+	Timeout:      15 * time.Second,
+	LatencyMS:    1,
+	FlowControl:  true,
+}
+
+func (p USBParams) validate() error {
+	if p.TransferSize < 64 || p.TransferSize > 65536 || p.TransferSize%64 != 0 {
+		return fmt.Errorf("invalid USB transfer size: %d", p.TransferSize)
+	}
+	if p.Timeout < time.Millisecond {
+		return fmt.Errorf("invalid USB timeout: %s", p.Timeout)
+	}
+	if p.LatencyMS < 1 || p.LatencyMS > 255 {
+		return fmt.Errorf("invalid latency timer: %d ms", p.LatencyMS)
+	}
+	return nil
+}
+
+func (p USBParams) String() string {
+	flow := "none"
+	if p.FlowControl {
+		flow = "RTS/CTS"
+	}
+	return fmt.Sprintf("transfer=%d timeout=%s latency=%dms flow=%s", p.TransferSize, p.Timeout, p.LatencyMS, flow)
+}
+
 // setupCommon is the general setup for common devices.
 //
 // It tries first the 'happy path' which doesn't reset the device. By doing so,
 // the goal is to reduce the amount of glitches on the GPIO pins, on a best
 // effort basis. On all devices, the GPIOs are still reset as inputs, since
 // there is no way to determine if each GPIO is an input or output.
-func (d *device) setupCommon() error {
+func (d *device) setupCommon(p USBParams) error {
 	// Driver: maximum packet size. Note that this clears any data in the buffer,
 	// so it is good to do it immediately after a reset. The 'out' parameter is
 	// ignored.
-	// TODO(maruel): The FT232H doc claims a 512 byte packets support in hi-speed
-	// mode, which means that this would likely be better to use this value.
-	if e := d.h.d2xxSetUSBParameters(65536, 0); e != 0 {
+	if e := d.h.d2xxSetUSBParameters(p.TransferSize, 0); e != 0 {
 		return toErr("SetUSBParameters", e)
 	}
-	// Driver: Set I/O timeouts to 15 sec. The reason is that we want the
-	// timeouts to be very visible, at least as the driver is being developed.
-	if e := d.h.d2xxSetTimeouts(15000, 15000); e != 0 {
+	ms := int(p.Timeout.Milliseconds())
+	if e := d.h.d2xxSetTimeouts(ms, ms); e != 0 {
 		return toErr("SetTimeouts", e)
 	}
-	// Not sure: Disable event/error characters.
+	// Disable event/error characters.
 	if e := d.h.d2xxSetChars(0, false, 0, false); e != 0 {
 		return toErr("SetChars", e)
 	}
-	// Not sure: Latency timer at 1ms.
-	if e := d.h.d2xxSetLatencyTimer(1); e != 0 {
+	if e := d.h.d2xxSetLatencyTimer(uint8(p.LatencyMS)); e != 0 {
 		return toErr("SetLatencyTimer", e)
 	}
-	// Not sure: Turn on flow control to synchronize IN requests.
-	if e := d.h.d2xxSetFlowControl(); e != 0 {
+	// Flow control synchronizes the IN requests.
+	if e := d.h.d2xxSetFlowControl(p.FlowControl); e != 0 {
 		return toErr("SetFlowControl", e)
 	}
 	// Just in case. It's a very small cost.
@@ -180,14 +224,17 @@ func (d *device) read(b []byte) (int, error) {
 		v = len(b)
 	}
 	n, e := d.h.d2xxRead(b[:v])
+	if d.rec != nil {
+		d.rec.transfer("read", b[:n])
+	}
 	return n, toErr("Read", e)
 }
 
 // readAll blocks to return all the data.
+//
+// It sleeps on the driver while no byte is queued, and fails with ErrTimeout
+// when none arrived for readTimeout.
 func (d *device) readAll(b []byte) error {
-	// TODO(maruel): Use FT_SetEventNotification() instead of looping when
-	// waiting for bytes.
-	last := time.Now()
 	for offset := 0; offset != len(b); {
 		chunk := len(b) - offset
 		if chunk > 4096 {
@@ -199,9 +246,14 @@ func (d *device) readAll(b []byte) error {
 		}
 		if p != 0 {
 			offset += p
-			last = time.Now()
-		} else if time.Since(last) > 200*time.Millisecond {
-			return io.EOF
+			continue
+		}
+		q, e := d.h.d2xxWaitRx(d.readTimeout)
+		if e != 0 {
+			return toErr("WaitRx", e)
+		}
+		if q == 0 {
+			return ErrTimeout
 		}
 	}
 	return nil
@@ -213,6 +265,9 @@ func (d *device) readAll(b []byte) error {
 func (d *device) write(b []byte) (int, error) {
 	// Use a stronger guarantee that all bytes have been written.
 	n, e := d.h.d2xxWrite(b)
+	if d.rec != nil {
+		d.rec.transfer("write", b[:n])
+	}
 	return n, toErr("Write", e)
 }
 
@@ -375,57 +430,10 @@ const (
 )
 
 func toErr(s string, e int) error {
-	msg := ""
-	switch e {
-	case missing:
-		// when the library d2xx couldn't be loaded at runtime.
-		msg = "couldn't load driver; visit https://periph.io/device/ftdi/ for help"
-	case noCGO:
-		msg = "can't be used without cgo"
-	case 0: // FT_OK
+	if e == 0 { // FT_OK
 		return nil
-	case 1: // FT_INVALID_HANDLE
-		msg = "invalid handle"
-	case 2: // FT_DEVICE_NOT_FOUND
-		msg = "device not found; see https://periph.io/device/ftdi/ for help"
-	case 3: // FT_DEVICE_NOT_OPENED
-		msg = "device busy; see https://periph.io/device/ftdi/ for help"
-	case 4: // FT_IO_ERROR
-		msg = "I/O error"
-	case 5: // FT_INSUFFICIENT_RESOURCES
-		msg = "insufficient resources"
-	case 6: // FT_INVALID_PARAMETER
-		msg = "invalid parameter"
-	case 7: // FT_INVALID_BAUD_RATE
-		msg = "invalid baud rate"
-	case 8: // FT_DEVICE_NOT_OPENED_FOR_ERASE
-		msg = "device not opened for erase"
-	case 9: // FT_DEVICE_NOT_OPENED_FOR_WRITE
-		msg = "device not opened for write"
-	case 10: // FT_FAILED_TO_WRITE_DEVICE
-		msg = "failed to write device"
-	case 11: // FT_EEPROM_READ_FAILED
-		msg = "eeprom read failed"
-	case 12: // FT_EEPROM_WRITE_FAILED
-		msg = "eeprom write failed"
-	case 13: // FT_EEPROM_ERASE_FAILED
-		msg = "eeprom erase failed"
-	case 14: // FT_EEPROM_NOT_PRESENT
-		msg = "eeprom not present"
-	case 15: // FT_EEPROM_NOT_PROGRAMMED
-		msg = "eeprom not programmed"
-	case 16: // FT_INVALID_ARGS
-		msg = "invalid argument"
-	case 17: // FT_NOT_SUPPORTED
-		msg = "not supported"
-	case 18: // FT_OTHER_ERROR
-		msg = "other error"
-	case 19: // FT_DEVICE_LIST_NOT_READY
-		msg = "device list not ready"
-	default:
-		msg = "unknown status " + strconv.Itoa(e)
 	}
-	return errors.New("d2xx: " + s + ": " + msg)
+	return &Error{Op: s, Status: Status(e)}
 }
 
 // Common functions that must be implemented in addition to
@@ -434,7 +442,7 @@ type d2xxHandle interface {
 	d2xxClose() int
 	// d2xxResetDevice takes >1.2ms
 	d2xxResetDevice() int
-	d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, int)
+	d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, string, int)
 	d2xxEEPROMRead(d ftdi.DevType, e *ftdi.EEPROM) int
 	d2xxEEPROMProgram(e *ftdi.EEPROM) int
 	d2xxEraseEE() int
@@ -444,12 +452,15 @@ type d2xxHandle interface {
 	d2xxEEUAWrite(ua []byte) int
 	d2xxSetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) int
 	d2xxSetUSBParameters(in, out int) int
-	d2xxSetFlowControl() int
+	d2xxSetFlowControl(rtsCts bool) int
 	d2xxSetTimeouts(readMS, writeMS int) int
 	d2xxSetLatencyTimer(delayMS uint8) int
 	d2xxSetBaudRate(hz uint32) int
 	// d2xxGetQueueStatus takes >60µs
 	d2xxGetQueueStatus() (uint32, int)
+	// d2xxWaitRx blocks until bytes are queued or timeout elapsed, and
+	// returns how many are queued, like d2xxGetQueueStatus.
+	d2xxWaitRx(timeout time.Duration) (uint32, int)
 	// d2xxRead takes <5µs if d2xxGetQueueStatus was called just before,
 	// 300µs~800µs otherwise (!)
 	d2xxRead(b []byte) (int, int)
@@ -468,6 +479,36 @@ type handle uintptr
 // d2xxLoggingHandle adds logging to help diagnose issues with the d2xx driver.
 type d2xxLoggingHandle struct {
 	d d2xxHandle
+	l *log.Logger
+	n int // payload bytes dumped, the rest is elided; <=0 for all
+}
+
+// hexDump formats a payload as hex, truncated to n bytes.
+type hexDump struct {
+	b []byte
+	n int
+}
+
+func (h hexDump) String() string {
+	if h.n <= 0 || len(h.b) <= h.n {
+		return fmt.Sprintf("%#x", h.b)
+	}
+	return fmt.Sprintf("%#x... (%d bytes)", h.b[:h.n], len(h.b))
+}
+
+// tracingOpener wraps the handles returned by opener in a d2xxLoggingHandle
+// writing to w.
+func tracingOpener(opener func(i int) (d2xxHandle, int), w io.Writer, n int) func(i int) (d2xxHandle, int) {
+	l := log.New(w, "", log.LstdFlags|log.Lmicroseconds)
+	return func(i int) (d2xxHandle, int) {
+		h, e := opener(i)
+		l.Printf("d2xxOpen(%d) = %d", i, e)
+		return &d2xxLoggingHandle{d: h, l: l, n: n}, e
+	}
+}
+
+func (d *d2xxLoggingHandle) dump(b []byte) hexDump {
+	return hexDump{b, d.n}
 }
 
 // log10 is a cheap way to find the most significant digit
@@ -521,103 +562,113 @@ func roundDuration(d time.Duration) time.Duration {
 	return d
 }
 
-func logDefer(fmt string) func(args ...interface{}) {
+func (d *d2xxLoggingHandle) logDefer(fmt string) func(args ...interface{}) {
 	var start time.Time
 	f := func(args ...interface{}) {
-		log.Printf("%7s "+fmt, append([]interface{}{roundDuration(time.Since(start))}, args...)...)
+		d.l.Printf("%7s "+fmt, append([]interface{}{roundDuration(time.Since(start))}, args...)...)
 	}
 	start = time.Now()
 	return f
 }
 
 func (d *d2xxLoggingHandle) d2xxClose() int {
-	defer logDefer("d2xxClose()")()
+	defer d.logDefer("d2xxClose()")()
 	return d.d.d2xxClose()
 }
-func (d d2xxLoggingHandle) d2xxResetDevice() int {
-	defer logDefer("d2xxResetDevice()")()
+func (d *d2xxLoggingHandle) d2xxResetDevice() int {
+	defer d.logDefer("d2xxResetDevice()")()
 	return d.d.d2xxResetDevice()
 }
-func (d d2xxLoggingHandle) d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, int) {
-	defer logDefer("d2xxGetDeviceInfo()")()
-	return d.d.d2xxGetDeviceInfo()
+func (d *d2xxLoggingHandle) d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, string, int) {
+	f := d.logDefer("d2xxGetDeviceInfo() = %s, %04x, %04x, %q, %d")
+	t, venID, devID, serial, e := d.d.d2xxGetDeviceInfo()
+	f(t, venID, devID, serial, e)
+	return t, venID, devID, serial, e
 }
-func (d d2xxLoggingHandle) d2xxEEPROMRead(dev ftdi.DevType, e *ftdi.EEPROM) int {
-	defer logDefer("d2xxEEPROMRead(%v, %d bytes)")(dev, e)
+func (d *d2xxLoggingHandle) d2xxEEPROMRead(dev ftdi.DevType, e *ftdi.EEPROM) int {
+	defer d.logDefer("d2xxEEPROMRead(%v, %d bytes)")(dev, e)
 	return d.d.d2xxEEPROMRead(dev, e)
 }
-func (d d2xxLoggingHandle) d2xxEEPROMProgram(e *ftdi.EEPROM) int {
-	defer logDefer("d2xxEEPROMProgram(%#x)")(e)
+func (d *d2xxLoggingHandle) d2xxEEPROMProgram(e *ftdi.EEPROM) int {
+	defer d.logDefer("d2xxEEPROMProgram(%#x)")(e)
 	return d.d.d2xxEEPROMProgram(e)
 }
-func (d d2xxLoggingHandle) d2xxEraseEE() int {
-	defer logDefer("d2xxEraseEE()")()
+func (d *d2xxLoggingHandle) d2xxEraseEE() int {
+	defer d.logDefer("d2xxEraseEE()")()
 	return d.d.d2xxEraseEE()
 }
-func (d d2xxLoggingHandle) d2xxWriteEE(offset uint8, value uint16) int {
-	defer logDefer("d2xxWriteEE(%d, %d)")(offset, value)
+func (d *d2xxLoggingHandle) d2xxWriteEE(offset uint8, value uint16) int {
+	defer d.logDefer("d2xxWriteEE(%d, %d)")(offset, value)
 	return d.d.d2xxWriteEE(offset, value)
 }
-func (d d2xxLoggingHandle) d2xxEEUASize() (int, int) {
-	defer logDefer("d2xxEEUASize()")()
+func (d *d2xxLoggingHandle) d2xxEEUASize() (int, int) {
+	defer d.logDefer("d2xxEEUASize()")()
 	return d.d.d2xxEEUASize()
 }
-func (d d2xxLoggingHandle) d2xxEEUARead(ua []byte) int {
-	defer logDefer("d2xxEEUARead(%d bytes)")(len(ua))
+func (d *d2xxLoggingHandle) d2xxEEUARead(ua []byte) int {
+	defer d.logDefer("d2xxEEUARead(%d bytes)")(len(ua))
 	return d.d.d2xxEEUARead(ua)
 }
-func (d d2xxLoggingHandle) d2xxEEUAWrite(ua []byte) int {
-	defer logDefer("d2xxEEUAWrite(%#x)")(ua)
+func (d *d2xxLoggingHandle) d2xxEEUAWrite(ua []byte) int {
+	defer d.logDefer("d2xxEEUAWrite(%v)")(d.dump(ua))
 	return d.d.d2xxEEUAWrite(ua)
 }
-func (d d2xxLoggingHandle) d2xxSetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) int {
-	defer logDefer("d2xxSetChars(%d, %t, %d, %t)")(eventChar, eventEn, errorChar, errorEn)
+func (d *d2xxLoggingHandle) d2xxSetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) int {
+	defer d.logDefer("d2xxSetChars(%d, %t, %d, %t)")(eventChar, eventEn, errorChar, errorEn)
 	return d.d.d2xxSetChars(eventChar, eventEn, errorChar, errorEn)
 }
-func (d d2xxLoggingHandle) d2xxSetUSBParameters(in, out int) int {
-	defer logDefer("d2xxSetUSBParameters(%d, %d)")(in, out)
+func (d *d2xxLoggingHandle) d2xxSetUSBParameters(in, out int) int {
+	defer d.logDefer("d2xxSetUSBParameters(%d, %d)")(in, out)
 	return d.d.d2xxSetUSBParameters(in, out)
 }
-func (d d2xxLoggingHandle) d2xxSetFlowControl() int {
-	defer logDefer("d2xxSetFlowControl()")()
-	return d.d.d2xxSetFlowControl()
+func (d *d2xxLoggingHandle) d2xxSetFlowControl(rtsCts bool) int {
+	defer d.logDefer("d2xxSetFlowControl(%t)")(rtsCts)
+	return d.d.d2xxSetFlowControl(rtsCts)
 }
-func (d d2xxLoggingHandle) d2xxSetTimeouts(readMS, writeMS int) int {
-	defer logDefer("d2xxSetTimeouts(%d, %d)")(readMS, writeMS)
+func (d *d2xxLoggingHandle) d2xxSetTimeouts(readMS, writeMS int) int {
+	defer d.logDefer("d2xxSetTimeouts(%d, %d)")(readMS, writeMS)
 	return d.d.d2xxSetTimeouts(readMS, writeMS)
 }
-func (d d2xxLoggingHandle) d2xxSetLatencyTimer(delayMS uint8) int {
-	defer logDefer("d2xxSetLatencyTimer(%d)")(delayMS)
+func (d *d2xxLoggingHandle) d2xxSetLatencyTimer(delayMS uint8) int {
+	defer d.logDefer("d2xxSetLatencyTimer(%d)")(delayMS)
 	return d.d.d2xxSetLatencyTimer(delayMS)
 }
-func (d d2xxLoggingHandle) d2xxSetBaudRate(hz uint32) int {
-	defer logDefer("d2xxSetBaudRate(%d)")(hz)
+func (d *d2xxLoggingHandle) d2xxSetBaudRate(hz uint32) int {
+	defer d.logDefer("d2xxSetBaudRate(%d)")(hz)
 	return d.d.d2xxSetBaudRate(hz)
 }
-func (d d2xxLoggingHandle) d2xxGetQueueStatus() (uint32, int) {
-	f := logDefer("d2xxGetQueueStatus() = %d, %d")
+func (d *d2xxLoggingHandle) d2xxGetQueueStatus() (uint32, int) {
+	f := d.logDefer("d2xxGetQueueStatus() = %d, %d")
 	p, e := d.d.d2xxGetQueueStatus()
 	f(p, e)
 	return p, e
 }
-func (d d2xxLoggingHandle) d2xxRead(b []byte) (int, int) {
-	f := logDefer("d2xxRead(%d bytes) = %#x")
+func (d *d2xxLoggingHandle) d2xxWaitRx(timeout time.Duration) (uint32, int) {
+	f := d.logDefer("d2xxWaitRx(%s) = %d, %d")
+	p, e := d.d.d2xxWaitRx(timeout)
+	f(timeout, p, e)
+	return p, e
+}
+func (d *d2xxLoggingHandle) d2xxRead(b []byte) (int, int) {
+	f := d.logDefer("d2xxRead(%d bytes) = %v")
 	n, e := d.d.d2xxRead(b)
-	f(len(b), b[:n])
+	f(len(b), d.dump(b[:n]))
 	return n, e
 }
-func (d d2xxLoggingHandle) d2xxWrite(b []byte) (int, int) {
-	defer logDefer("d2xxWrite(%#x)")(b)
-	return d.d.d2xxWrite(b)
+func (d *d2xxLoggingHandle) d2xxWrite(b []byte) (int, int) {
+	f := d.logDefer("d2xxWrite(%v) = %d, %d")
+	n, e := d.d.d2xxWrite(b)
+	f(d.dump(b), n, e)
+	return n, e
 }
-func (d d2xxLoggingHandle) d2xxGetBitMode() (byte, int) {
-	f := logDefer("d2xxGetBitMode() = %02X")
+func (d *d2xxLoggingHandle) d2xxGetBitMode() (byte, int) {
+	f := d.logDefer("d2xxGetBitMode() = %02X")
 	b, e := d.d.d2xxGetBitMode()
 	f(b)
 	return b, e
 }
-func (d d2xxLoggingHandle) d2xxSetBitMode(mask, mode byte) int {
-	f := logDefer("d2xxSetBitMode(0x%02X, 0x%02X) = %d")
+func (d *d2xxLoggingHandle) d2xxSetBitMode(mask, mode byte) int {
+	f := d.logDefer("d2xxSetBitMode(0x%02X, 0x%02X) = %d")
 	e := d.d.d2xxSetBitMode(mask, mode)
 	f(mask, mode, e)
 	return e
@@ -9,9 +9,88 @@ package d2xx
 /*
 #include "ftd2xx.h"
 #include <stdlib.h>
+
+#ifndef _WIN32
+#include <errno.h>
+#include <sys/time.h>
+#endif
+
+// rx_event is signaled by the driver when bytes are received.
+typedef struct {
+#ifdef _WIN32
+	HANDLE h;
+#else
+	EVENT_HANDLE e;
+#endif
+} rx_event;
+
+static rx_event *rx_event_new(FT_HANDLE ft, FT_STATUS *status) {
+	rx_event *ev = calloc(1, sizeof(rx_event));
+	if (ev == NULL) {
+		*status = FT_INSUFFICIENT_RESOURCES;
+		return NULL;
+	}
+#ifdef _WIN32
+	ev->h = CreateEvent(NULL, FALSE, FALSE, NULL);
+	*status = FT_SetEventNotification(ft, FT_EVENT_RXCHAR, ev->h);
+#else
+	pthread_mutex_init(&ev->e.eMutex, NULL);
+	pthread_cond_init(&ev->e.eCondVar, NULL);
+	*status = FT_SetEventNotification(ft, FT_EVENT_RXCHAR, &ev->e);
+#endif
+	return ev;
+}
+
+static void rx_event_free(rx_event *ev) {
+#ifdef _WIN32
+	CloseHandle(ev->h);
+#else
+	pthread_cond_destroy(&ev->e.eCondVar);
+	pthread_mutex_destroy(&ev->e.eMutex);
+#endif
+	free(ev);
+}
+
+// rx_event_wait waits up to ms for bytes to be queued and returns how many
+// are.
+static FT_STATUS rx_event_wait(FT_HANDLE ft, rx_event *ev, DWORD ms, DWORD *rx) {
+	FT_STATUS status;
+#ifdef _WIN32
+	status = FT_GetQueueStatus(ft, rx);
+	if (status != FT_OK || *rx != 0) {
+		return status;
+	}
+	WaitForSingleObject(ev->h, ms);
+	return FT_GetQueueStatus(ft, rx);
+#else
+	struct timeval now;
+	struct timespec deadline;
+	gettimeofday(&now, NULL);
+	deadline.tv_sec = now.tv_sec + ms / 1000;
+	deadline.tv_nsec = now.tv_usec * 1000 + (ms % 1000) * 1000000;
+	if (deadline.tv_nsec >= 1000000000) {
+		deadline.tv_sec++;
+		deadline.tv_nsec -= 1000000000;
+	}
+
+	// the driver signals with the mutex held: no event is lost between the
+	// check and the wait
+	pthread_mutex_lock(&ev->e.eMutex);
+	while ((status = FT_GetQueueStatus(ft, rx)) == FT_OK && *rx == 0) {
+		if (pthread_cond_timedwait(&ev->e.eCondVar, &ev->e.eMutex, &deadline) == ETIMEDOUT) {
+			status = FT_GetQueueStatus(ft, rx);
+			break;
+		}
+	}
+	pthread_mutex_unlock(&ev->e.eMutex);
+	return status;
+#endif
+}
 */
 import "C"
 import (
+	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/ysh86/ftPIC/d2xx/ftdi"
@@ -45,20 +124,28 @@ func d2xxOpen(i int) (d2xxHandle, int) {
 }
 
 func (h handle) d2xxClose() int {
-	return int(C.FT_Close(h.toH()))
+	e := C.FT_Close(h.toH())
+	rxEvents.Lock()
+	if ev, ok := rxEvents.m[h]; ok {
+		C.rx_event_free(ev)
+		delete(rxEvents.m, h)
+	}
+	rxEvents.Unlock()
+	return int(e)
 }
 
 func (h handle) d2xxResetDevice() int {
 	return int(C.FT_ResetDevice(h.toH()))
 }
 
-func (h handle) d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, int) {
+func (h handle) d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, string, int) {
 	var dev C.FT_DEVICE
 	var id C.DWORD
-	if e := C.FT_GetDeviceInfo(h.toH(), &dev, &id, nil, nil, nil); e != 0 {
-		return ftdi.Unknown, 0, 0, int(e)
+	var serial [16]C.char
+	if e := C.FT_GetDeviceInfo(h.toH(), &dev, &id, &serial[0], nil, nil); e != 0 {
+		return ftdi.Unknown, 0, 0, "", int(e)
 	}
-	return ftdi.DevType(dev), uint16(id >> 16), uint16(id), 0
+	return ftdi.DevType(dev), uint16(id >> 16), uint16(id), C.GoString(&serial[0]), 0
 }
 
 func (h handle) d2xxEEPROMRead(t ftdi.DevType, ee *ftdi.EEPROM) int {
@@ -175,8 +262,12 @@ func (h handle) d2xxSetUSBParameters(in, out int) int {
 	return int(C.FT_SetUSBParameters(h.toH(), C.DWORD(in), C.DWORD(out)))
 }
 
-func (h handle) d2xxSetFlowControl() int {
-	return int(C.FT_SetFlowControl(h.toH(), C.FT_FLOW_RTS_CTS, 0, 0))
+func (h handle) d2xxSetFlowControl(rtsCts bool) int {
+	flow := C.USHORT(C.FT_FLOW_NONE)
+	if rtsCts {
+		flow = C.FT_FLOW_RTS_CTS
+	}
+	return int(C.FT_SetFlowControl(h.toH(), flow, 0, 0))
 }
 
 func (h handle) d2xxSetTimeouts(readMS, writeMS int) int {
@@ -197,6 +288,37 @@ func (h handle) d2xxGetQueueStatus() (uint32, int) {
 	return uint32(v), int(e)
 }
 
+// rxEvents holds the event notified by the driver of each handle, created by
+// the first d2xxWaitRx.
+var rxEvents = struct {
+	sync.Mutex
+	m map[handle]*C.rx_event
+}{m: map[handle]*C.rx_event{}}
+
+func (h handle) d2xxWaitRx(timeout time.Duration) (uint32, int) {
+	rxEvents.Lock()
+	ev, ok := rxEvents.m[h]
+	if !ok {
+		var e C.FT_STATUS
+		ev = C.rx_event_new(h.toH(), &e)
+		if e != 0 {
+			if ev != nil {
+				C.rx_event_free(ev)
+			}
+			rxEvents.Unlock()
+			return 0, int(e)
+		}
+		rxEvents.m[h] = ev
+	}
+	rxEvents.Unlock()
+
+	// rounded up: a timeout below 1ms must not turn into a poll
+	ms := max(1, (timeout+time.Millisecond-1)/time.Millisecond)
+	var rx C.DWORD
+	e := C.rx_event_wait(h.toH(), ev, C.DWORD(ms), &rx)
+	return uint32(rx), int(e)
+}
+
 func (h handle) d2xxRead(b []byte) (int, int) {
 	var bytesRead C.DWORD
 	e := C.FT_Read(h.toH(), C.LPVOID(unsafe.Pointer(&b[0])), C.DWORD(len(b)), &bytesRead)
@@ -0,0 +1,126 @@
+package d2xx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Device describes the memory layout of a supported target.
+type Device struct {
+	Name string
+	ID   uint16
+
+	// Program Flash Memory
+	PFMSize  int // [bytes]
+	PageSize int // [bytes] erase page
+
+	EEPROMSize int // [bytes]
+	Pins       int
+
+	// Device Information Area, Device Configuration Information
+	DIAAddr uint32
+	DCIAddr uint32
+
+	// Configuration bytes
+	ConfigSize int
+	Config     []ConfigField
+
+	Timing Timing
+}
+
+var devices = []*Device{
+	{
+		Name:     "PIC18F47Q43",
+		ID:       0x74A0,
+		PFMSize:  0x2_0000,
+		PageSize: 128 * 2,
+
+		EEPROMSize: 1024,
+		Pins:       40,
+
+		DIAAddr: 0x2C_0000,
+		DCIAddr: 0x3C_0000,
+
+		ConfigSize: 10,
+		Config:     configQ43,
+
+		Timing: timingQ43,
+	},
+}
+
+// Memory map common to the PIC18 Q-series.
+const (
+	addrUserID   = 0x20_0000
+	addrConfig   = 0x30_0000
+	addrEEPROM   = 0x38_0000
+	addrRevision = 0x3f_fffc
+
+	sizeUserID = 32 * 2
+)
+
+// MemoryRegion is a region of the target memory map.
+type MemoryRegion struct {
+	AddressRange
+	Region Region
+	Name   string
+	Unit   int // [bytes] programmed at once: 2 for words, 1 for bytes
+}
+
+// Regions returns the programmable regions in programming order; the
+// configuration bytes come last since they may protect the others.
+func (d *Device) Regions() []MemoryRegion {
+	return []MemoryRegion{
+		{AddressRange{0, uint32(d.PFMSize)}, REGION_FLASH, "PFM", 2},
+		{AddressRange{addrEEPROM, addrEEPROM + uint32(d.EEPROMSize)}, REGION_DATA_EEPROM, "EEPROM", 1},
+		{AddressRange{addrUserID, addrUserID + sizeUserID}, REGION_USER_ID, "User IDs", 2},
+		{AddressRange{addrConfig, addrConfig + uint32(d.ConfigSize)}, REGION_CONFIGURATION, "Configuration", 1},
+	}
+}
+
+// Region returns the memory region r.
+func (d *Device) Region(r Region) (MemoryRegion, bool) {
+	for _, mr := range d.Regions() {
+		if mr.Region == r {
+			return mr, true
+		}
+	}
+	return MemoryRegion{}, false
+}
+
+func lookupDevice(id uint16) *Device {
+	for _, d := range devices {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// DeviceByName returns the supported device named name, or nil.
+func DeviceByName(name string) *Device {
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, name) {
+			return d
+		}
+	}
+	return nil
+}
+
+// AddressRange is the half-open range [Start, End) of target addresses.
+type AddressRange struct {
+	Start uint32
+	End   uint32
+}
+
+func (r AddressRange) contains(addr uint32) bool {
+	return r.Start <= addr && addr < r.End
+}
+
+// Overlaps reports whether r and o share at least one address.
+func (r AddressRange) Overlaps(o AddressRange) bool {
+	return r.Start < o.End && o.Start < r.End
+}
+
+func (r AddressRange) String() string {
+	return fmt.Sprintf("%06x-%06x", r.Start, r.End-1)
+}
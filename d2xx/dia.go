@@ -0,0 +1,74 @@
+package d2xx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DIA is the Device Information Area, programmed at the factory.
+type DIA struct {
+	MUI  [9]uint16  // Microchip Unique Identifier
+	_    uint16     // reserved
+	EUI  [10]uint16 // optional External Unique Identifier
+	TSLR [3]uint16  // temperature sensor parameters, low range
+	TSHR [3]uint16  // temperature sensor parameters, high range
+	FVRA [3]uint16  // ADC FVR1 output voltage for 1x, 2x, 4x [mV]
+	FVRC [3]uint16  // comparator FVR2 output voltage for 1x, 2x, 4x [mV]
+}
+
+// UniqueID returns the MUI as a hex string, MUI0 first.
+func (d *DIA) UniqueID() string {
+	var b strings.Builder
+	for _, w := range d.MUI {
+		fmt.Fprintf(&b, "%04X", w)
+	}
+	return b.String()
+}
+
+func (d *DIA) decode(words []uint16) {
+	n := copy(d.MUI[:], words)
+	n++
+	n += copy(d.EUI[:], words[n:])
+	n += copy(d.TSLR[:], words[n:])
+	n += copy(d.TSHR[:], words[n:])
+	n += copy(d.FVRA[:], words[n:])
+	copy(d.FVRC[:], words[n:])
+}
+
+// DCI is the Device Configuration Information, programmed at the factory.
+type DCI struct {
+	ERSIZ uint16 // erase page size [words]
+	WLSIZ uint16 // number of write latches per row [words]
+	URSIZ uint16 // number of user erasable pages
+	EESIZ uint16 // data EEPROM size [bytes]
+	PCNT  uint16 // pin count
+}
+
+func (c *DCI) decode(words []uint16) {
+	c.ERSIZ = words[0]
+	c.WLSIZ = words[1]
+	c.URSIZ = words[2]
+	c.EESIZ = words[3]
+	c.PCNT = words[4]
+}
+
+// Check cross-checks the DCI against the device database.
+func (c *DCI) Check(dev *Device) error {
+	var diffs []string
+	if int(c.ERSIZ)*2 != dev.PageSize {
+		diffs = append(diffs, fmt.Sprintf("erase page %d words, expected %d", c.ERSIZ, dev.PageSize/2))
+	}
+	if int(c.URSIZ)*int(c.ERSIZ)*2 != dev.PFMSize {
+		diffs = append(diffs, fmt.Sprintf("PFM %d pages, expected %d", c.URSIZ, dev.PFMSize/dev.PageSize))
+	}
+	if int(c.EESIZ) != dev.EEPROMSize {
+		diffs = append(diffs, fmt.Sprintf("EEPROM %d bytes, expected %d", c.EESIZ, dev.EEPROMSize))
+	}
+	if dev.Pins != 0 && int(c.PCNT) != dev.Pins {
+		diffs = append(diffs, fmt.Sprintf("%d pins, expected %d", c.PCNT, dev.Pins))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("DCI does not match %s: %s", dev.Name, strings.Join(diffs, ", "))
+	}
+	return nil
+}
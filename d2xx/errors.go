@@ -0,0 +1,140 @@
+package d2xx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Sentinel errors, to be tested with errors.Is.
+var (
+	// ErrDriverMissing is returned when the D2XX library can't be used.
+	ErrDriverMissing = errors.New("d2xx: driver not available")
+	// ErrDeviceNotFound is returned when no usable programmer is connected.
+	ErrDeviceNotFound = errors.New("d2xx: device not found")
+	// ErrDeviceBusy is returned when the programmer is opened by another
+	// process, or held by the VCP driver.
+	ErrDeviceBusy = errors.New("d2xx: device busy")
+	// ErrTimeout is returned when the programmer stops returning data.
+	ErrTimeout = errors.New("d2xx: read timeout")
+	// ErrNoMPSSE is returned when the MPSSE doesn't answer as expected.
+	ErrNoMPSSE = errors.New("d2xx: MPSSE not responding")
+
+	// ErrTargetNotResponding is returned when the device ID reads back as
+	// all zeros or all ones: nothing drives ICSPDAT.
+	ErrTargetNotResponding = errors.New("target not responding")
+	// ErrUnknownDevice is returned when the device ID isn't supported.
+	ErrUnknownDevice = errors.New("unknown target device")
+	// ErrShortData is returned when the data is smaller than the region.
+	ErrShortData = errors.New("not enough data")
+	// ErrVerify is returned when the read back data differs.
+	ErrVerify = errors.New("verify failed")
+	// ErrDangerousConfig is returned when a configuration which may lock
+	// out this programmer is refused.
+	ErrDangerousConfig = errors.New("dangerous configuration")
+)
+
+// Status is an FT_STATUS code, or one of the negative codes of this package
+// when the driver couldn't be called at all.
+type Status int
+
+func (s Status) String() string {
+	switch s {
+	case missing:
+		// when the library d2xx couldn't be loaded at runtime.
+		return "couldn't load driver; visit https://periph.io/device/ftdi/ for help"
+	case noCGO:
+		return "can't be used without cgo"
+	case 0: // FT_OK
+		return "ok"
+	case 1: // FT_INVALID_HANDLE
+		return "invalid handle"
+	case 2: // FT_DEVICE_NOT_FOUND
+		return "device not found; see https://periph.io/device/ftdi/ for help"
+	case 3: // FT_DEVICE_NOT_OPENED
+		return "device busy; see https://periph.io/device/ftdi/ for help"
+	case 4: // FT_IO_ERROR
+		return "I/O error"
+	case 5: // FT_INSUFFICIENT_RESOURCES
+		return "insufficient resources"
+	case 6: // FT_INVALID_PARAMETER
+		return "invalid parameter"
+	case 7: // FT_INVALID_BAUD_RATE
+		return "invalid baud rate"
+	case 8: // FT_DEVICE_NOT_OPENED_FOR_ERASE
+		return "device not opened for erase"
+	case 9: // FT_DEVICE_NOT_OPENED_FOR_WRITE
+		return "device not opened for write"
+	case 10: // FT_FAILED_TO_WRITE_DEVICE
+		return "failed to write device"
+	case 11: // FT_EEPROM_READ_FAILED
+		return "eeprom read failed"
+	case 12: // FT_EEPROM_WRITE_FAILED
+		return "eeprom write failed"
+	case 13: // FT_EEPROM_ERASE_FAILED
+		return "eeprom erase failed"
+	case 14: // FT_EEPROM_NOT_PRESENT
+		return "eeprom not present"
+	case 15: // FT_EEPROM_NOT_PROGRAMMED
+		return "eeprom not programmed"
+	case 16: // FT_INVALID_ARGS
+		return "invalid argument"
+	case 17: // FT_NOT_SUPPORTED
+		return "not supported"
+	case 18: // FT_OTHER_ERROR
+		return "other error"
+	case 19: // FT_DEVICE_LIST_NOT_READY
+		return "device list not ready"
+	}
+	return "unknown status " + strconv.Itoa(int(s))
+}
+
+// Error is returned when a D2XX call fails.
+type Error struct {
+	Op     string // D2XX function without the FT_ prefix, e.g. "Write"
+	Status Status
+}
+
+func (e *Error) Error() string {
+	return "d2xx: " + e.Op + ": " + e.Status.String()
+}
+
+// Is maps the status codes onto the sentinel errors.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrDriverMissing:
+		return e.Status == missing || e.Status == noCGO
+	case ErrDeviceNotFound:
+		return e.Status == 2 // FT_DEVICE_NOT_FOUND
+	case ErrDeviceBusy:
+		return e.Status == 3 // FT_DEVICE_NOT_OPENED
+	}
+	return false
+}
+
+// UnknownDeviceError is returned when the target's device ID isn't supported.
+type UnknownDeviceError struct {
+	DeviceID   uint16
+	RevisionID uint16
+}
+
+func (e *UnknownDeviceError) Error() string {
+	if errors.Is(e, ErrTargetNotResponding) {
+		return fmt.Sprintf("%s: device ID %04X", ErrTargetNotResponding, e.DeviceID)
+	}
+	return fmt.Sprintf("%s: %04X", ErrUnknownDevice, e.DeviceID)
+}
+
+func (e *UnknownDeviceError) Is(target error) bool {
+	switch target {
+	case ErrUnknownDevice:
+		return true
+	case ErrTargetNotResponding:
+		return e.DeviceID == 0x0000 || e.DeviceID == 0xffff
+	}
+	return false
+}
+
+func shortData(have, want int) error {
+	return fmt.Errorf("%w: %d bytes, %d expected", ErrShortData, have, want)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/ysh86/ftPIC/d2xx/ftdi"
@@ -12,7 +13,18 @@ import (
 type Flash struct {
 	// reader/writer
 	devA     *device
-	commands [8192 * 2]byte
+	serial   string // of devA, kept after Close
+	pins     *PinMap
+	clockHz  int
+	tckHz    int // times the waits
+	usb      USBParams
+	adapter  *AdapterRecord
+	timing   Timing
+	override Timing
+	low      byte // ADBUS levels and directions as last pushed
+	lowDir   byte
+	commands [128 * 1024]byte
+	results  [readBatch * 24]byte
 
 	// target
 	UserIDs       [32][2]byte
@@ -21,10 +33,15 @@ type Flash struct {
 	RevisionID    uint16
 	RevisionMajor string
 	RevisionMinor uint8
+	Device        *Device
+	DIA           DIA
+	DCI           DCI
 
 	// target: Program Flash Memory
 	lenPFM int
 	posPFM int
+
+	auditLog io.Writer
 }
 
 // Setting multiple bits is valid.
@@ -37,27 +54,158 @@ const (
 	REGION_CONFIGURATION Region = 0b1000
 )
 
-func OpenFlash() (*Flash, error) {
-	const (
-		SUPPORTED = ftdi.FT2232H
-	)
+const (
+	masterClockHz  = 60_000_000
+	DefaultClockHz = 2_000_000
+	MinClockHz     = 100_000
 
-	num, err := numDevices()
-	if err != nil {
-		return nil, err
+	// DefaultReadTimeout is how long a read waits for the next bytes.
+	DefaultReadTimeout = 200 * time.Millisecond
+
+	// readBatch is the number of words read per USB write: up to 290 bytes
+	// of commands each. Two batches are in flight at once, so up to
+	// 2*readBatch*24 bytes must fit in the driver's IN buffer.
+	readBatch = 256
+)
+
+var regionNames = []struct {
+	r    Region
+	name string
+}{
+	{REGION_FLASH, "PFM"},
+	{REGION_DATA_EEPROM, "EEPROM"},
+	{REGION_USER_ID, "UserID"},
+	{REGION_CONFIGURATION, "Config"},
+}
+
+func (r Region) names() []string {
+	var names []string
+	for _, n := range regionNames {
+		if r&n.r != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+func (r Region) String() string {
+	return strings.Join(r.names(), "|")
+}
+
+// Options configures OpenFlash. A nil *Options selects the defaults.
+type Options struct {
+	// Pins is the wiring of the target. Defaults to the AdapterRecord's, then
+	// PinsGPIO.
+	Pins *PinMap
+
+	// ClockHz is the ICSPCLK frequency, rounded down to what the MPSSE can
+	// divide. Defaults to the AdapterRecord's, then DefaultClockHz. When
+	// bit-banged, only the high half of the period is timed, since the target
+	// latches or drives ICSPDAT then: the low half lasts one GPIO command.
+	ClockHz int
+
+	// AutoClock halves the clock, down to MinClockHz, until the device ID
+	// reads back as a supported device and the programmer keeps up. Long
+	// cables need it.
+	AutoClock bool
+
+	// Timing overrides the non-zero delays of the device's Timing.
+	Timing Timing
+
+	// USB are the driver settings. Defaults to DefaultUSBParams.
+	USB *USBParams
+
+	// ReadTimeout is how long a read waits for the next bytes from the
+	// FT2232H before failing with ErrTimeout, rounded up to milliseconds.
+	// Defaults to DefaultReadTimeout.
+	ReadTimeout time.Duration
+
+	// Trace, when set, receives a line per D2XX call with its duration and
+	// the payloads, hex dumped up to TraceBytes each (0 for all).
+	Trace      io.Writer
+	TraceBytes int
+
+	// Record, when set, receives a capture of the bytes sent to and
+	// received from the MPSSE, see ReadCapture.
+	Record io.Writer
+
+	// Simulator, when set, is used instead of the first FT2232H. It is
+	// wired as Pins.
+	Simulator *Simulator
+
+	// IgnoreAdapterRecord skips the AdapterRecord of the EEPROM user area,
+	// otherwise used for Pins, ClockHz and Timing.Margin when unset.
+	IgnoreAdapterRecord bool
+}
+
+func OpenFlash(opts *Options) (*Flash, error) {
+	if opts == nil {
+		opts = &Options{}
 	}
-	if num < 2 {
-		return nil, fmt.Errorf("numDevices: %d", num)
+	usb := DefaultUSBParams
+	if opts.USB != nil {
+		usb = *opts.USB
+	}
+	if err := usb.validate(); err != nil {
+		return nil, err
 	}
 
-	// open 1st dev only
-	devA, err := openDev(d2xxOpen, 0)
+	devA, err := openFT2232H(opts)
 	if err != nil {
 		return nil, err
 	}
-	if devA.t != SUPPORTED {
+
+	// the record only fills what opts leave unset
+	var adapter *AdapterRecord
+	if !opts.IgnoreAdapterRecord {
+		adapter, err = devA.readRecord()
+		var e *Error
+		if errors.Is(err, ErrNoAdapterRecord) ||
+			errors.As(err, &e) && (e.Status == 14 || e.Status == 15) { // FT_EEPROM_NOT_PRESENT, FT_EEPROM_NOT_PROGRAMMED
+			// none, or no EEPROM to hold one
+			adapter, err = nil, nil
+		}
+		if err != nil {
+			devA.closeDev()
+			return nil, err
+		}
+	}
+	pins := opts.Pins
+	if pins == nil && adapter != nil && adapter.Pins != "" {
+		pins = PinMapByName(adapter.Pins)
+		if pins == nil {
+			devA.closeDev()
+			return nil, fmt.Errorf("adapter record: unknown pin map: %s", adapter.Pins)
+		}
+	}
+	if pins == nil {
+		pins = PinsGPIO
+	}
+	clockHz := opts.ClockHz
+	if clockHz <= 0 && adapter != nil {
+		clockHz = adapter.ClockHz
+	}
+	if clockHz <= 0 {
+		clockHz = DefaultClockHz
+	}
+	if clockHz > masterClockHz/2 {
 		devA.closeDev()
-		return nil, fmt.Errorf("device is not %s, but %s", SUPPORTED, devA.t)
+		return nil, fmt.Errorf("clock too fast: %d Hz > %d Hz", clockHz, masterClockHz/2)
+	}
+	override := opts.Timing
+	if override.Margin == 0 && adapter != nil {
+		override.Margin = adapter.Margin
+	}
+
+	if opts.Simulator != nil {
+		opts.Simulator.pins = pins
+	}
+	devA.readTimeout = opts.ReadTimeout
+	if devA.readTimeout <= 0 {
+		devA.readTimeout = DefaultReadTimeout
+	}
+	if opts.Record != nil {
+		devA.rec = newRecorder(opts.Record, pins)
 	}
 
 	// configure devices for MPSSE
@@ -66,7 +214,7 @@ func OpenFlash() (*Flash, error) {
 		devA.closeDev()
 		return nil, err
 	}
-	err = devA.setupCommon()
+	err = devA.setupCommon(usb)
 	if err != nil {
 		devA.closeDev()
 		return nil, err
@@ -77,7 +225,16 @@ func OpenFlash() (*Flash, error) {
 		return nil, err
 	}
 
-	f := &Flash{devA: devA}
+	f := &Flash{
+		devA:     devA,
+		serial:   devA.serial,
+		pins:     pins,
+		clockHz:  clockHz,
+		usb:      usb,
+		timing:   defaultTiming.override(override),
+		override: override,
+		adapter:  adapter,
+	}
 	time.Sleep(50 * time.Millisecond)
 
 	// try MPSSE
@@ -87,45 +244,99 @@ func OpenFlash() (*Flash, error) {
 		return nil, err
 	}
 
-	// setup GPIO
-	err = f.setupPICPins()
-	if err != nil {
-		f.Close()
-		return nil, err
-	}
+	for {
+		// setup GPIO
+		err = f.setupPICPins()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
 
-	// now ready to go
-	err = f.resetPIC()
-	if err != nil {
-		f.Close()
-		return nil, err
+		// now ready to go
+		err = f.resetPIC()
+		if err == nil {
+			break
+		}
+		garbled := errors.Is(err, ErrUnknownDevice) || errors.Is(err, ErrTimeout)
+		if !opts.AutoClock || !garbled || f.clockHz/2 < MinClockHz {
+			f.Close()
+			return nil, err
+		}
+
+		// garbled device ID or lost answers: leave the programming mode and
+		// retry slower
+		err = f.exitPIC()
+		if err == nil {
+			err = f.devA.flushPending()
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.clockHz /= 2
 	}
 
 	return f, nil
 }
 
+// Timing returns the programming delays in use.
+func (f *Flash) Timing() Timing {
+	return f.timing
+}
+
+// AdapterRecord returns the record found in the EEPROM user area of the
+// programmer, or nil.
+func (f *Flash) AdapterRecord() *AdapterRecord {
+	return f.adapter
+}
+
+// USB returns the driver settings in use.
+func (f *Flash) USB() USBParams {
+	return f.usb
+}
+
+// ClockHz returns the ICSPCLK frequency in use.
+func (f *Flash) ClockHz() int {
+	return f.clockHz
+}
+
+// exitPIC releases /MCLR, which makes the target leave the programming mode.
+func (f *Flash) exitPIC() error {
+	b := 0
+	e := 0
+
+	// /MCLR high
+	e = f.pushPins(f.pins.level(true, false, false), f.pins.Dir, e)
+	e = f.pushDelayTime(time.Millisecond, e)
+	_, err := f.devA.write(f.commands[b:e])
+	return err
+}
+
+// Close releases the target and the programmer. It reports the first error
+// met while recording the session, if any.
 func (f *Flash) Close() error {
+	var err error
 	if f.devA != nil {
 		b := 0
 		e := 0
 
 		// /MCLR high
-		f.commands[e] = 0x80
-		e++
-		f.commands[e] = 0b1000_0001 // /MCLR:1,   state:0,   ICSPDAT:0,   ICSPCLK:0
-		e++
-		f.commands[e] = 0b1111_1011 // /MCLR:Out, state:Out, ICSPDAT:Out, ICSPCLK:Out
-		e++
+		e = f.pushPins(f.pins.level(true, false, false), f.pins.Dir, e)
 		e = f.pushDelay(2, e)
 		f.devA.write(f.commands[b:e])
 
 		f.devA.setBitMode(0, bitModeReset)
 		f.devA.closeDev()
+		if f.devA.rec != nil {
+			err = f.devA.rec.err
+		}
 		f.devA = nil
 	}
-	return nil
+	return err
 }
 
+// Read reads the PFM from the current position. Odd positions and lengths
+// are fine: the words around them are read and only the requested bytes kept.
 func (f *Flash) Read(p []byte) (n int, err error) {
 	if f.posPFM >= f.lenPFM {
 		return n, io.EOF
@@ -138,43 +349,21 @@ func (f *Flash) Read(p []byte) (n int, err error) {
 	if f.posPFM+bytes > f.lenPFM {
 		bytes = f.lenPFM - f.posPFM
 	}
-	words := (bytes + 1) >> 1
+	start := f.posPFM &^ 1
+	end := (f.posPFM + bytes + 1) &^ 1
 
-	err = f.loadAddress(uint32(f.posPFM))
+	err = f.loadAddress(uint32(start))
 	if err != nil {
 		return n, err
 	}
-
-	i := 0
-	for bytes&1 == 0 && words-i >= 64 {
-		values, err := f.read64Words()
-		if err != nil {
-			return n, err
-		}
-		f.posPFM += 64 * 2
-
-		copy(p, values)
-		p = p[64*2:]
-		n += 64 * 2
-
-		i += 64
+	words := make([]byte, end-start)
+	err = f.readWordsTo(words)
+	if err != nil {
+		return n, err
 	}
-	for i < words {
-		value16, err := f.readWord()
-		if err != nil {
-			return n, err
-		}
-		f.posPFM += 2
-
-		p[i*2+0] = byte(value16[0])
-		n += 1
-		if bytes&1 == 0 {
-			p[i*2+1] = byte(value16[1])
-			n += 1
-		}
 
-		i++
-	}
+	n = copy(p[:bytes], words[f.posPFM-start:])
+	f.posPFM += n
 	return n, nil
 }
 
@@ -199,7 +388,13 @@ func (f *Flash) Seek(offset int64, whence int) (int64, error) {
 	return int64(f.posPFM), nil
 }
 
-func (f *Flash) BulkErase(regions Region) error {
+// BulkErase erases the regions.
+func (f *Flash) BulkErase(regions Region) (err error) {
+	defer f.audit("erase", regions, nil)(&err)
+	return f.bulkErase(regions)
+}
+
+func (f *Flash) bulkErase(regions Region) error {
 	b := 0
 	e := 0
 
@@ -212,8 +407,7 @@ func (f *Flash) BulkErase(regions Region) error {
 	e = f.pushByte(byte((r4_1>>8)&0xff), e)
 	e = f.pushByte(byte((r4_1>>0)&0xff), e)
 
-	// T ERAB: 11[msec]
-	e = f.pushDelayMillisecond(11, e)
+	e = f.pushDelayTime(f.timing.ERAB, e)
 
 	_, err := f.devA.write(f.commands[b:e])
 	if err != nil {
@@ -223,9 +417,16 @@ func (f *Flash) BulkErase(regions Region) error {
 	return nil
 }
 
-func (f *Flash) WritePFM(data []byte) error {
+func (f *Flash) WritePFM(data []byte) (err error) {
+	defer f.audit("write", REGION_FLASH, data)(&err)
 	if len(data) < f.lenPFM {
-		return errors.New("not enough data")
+		return shortData(len(data), f.lenPFM)
+	}
+
+	// the PC is wherever the last read or write left it
+	err = f.loadAddress(0)
+	if err != nil {
+		return err
 	}
 
 	for ii := 0; ii < f.lenPFM; ii += 128 {
@@ -244,10 +445,263 @@ func (f *Flash) WritePFM(data []byte) error {
 	return nil
 }
 
+// WritePFMProtected programs data like WritePFM, but erases the PFM page by
+// page instead of relying on BulkErase, and never erases nor programs the
+// pages inside the protected ranges. The ranges must be aligned to erase pages.
+func (f *Flash) WritePFMProtected(data []byte, protected []AddressRange) (err error) {
+	defer f.audit("write", REGION_FLASH, data)(&err)
+	if len(data) < f.lenPFM {
+		return shortData(len(data), f.lenPFM)
+	}
+
+	page := f.Device.PageSize
+	for _, r := range protected {
+		if r.Start >= r.End || int(r.End) > f.lenPFM {
+			return fmt.Errorf("invalid protected range: %s", r)
+		}
+		if int(r.Start)%page != 0 || int(r.End)%page != 0 {
+			return fmt.Errorf("protected range %s is not aligned to %d-byte erase pages", r, page)
+		}
+		for addr := r.Start; addr < r.End; addr++ {
+			if data[addr] != 0xff {
+				return fmt.Errorf("data at %06x is inside protected range %s", addr, r)
+			}
+		}
+	}
+
+	for ii := 0; ii < f.lenPFM; ii += page {
+		if isProtected(uint32(ii), protected) {
+			continue
+		}
+
+		err := f.loadAddress(uint32(ii))
+		if err != nil {
+			return err
+		}
+		err = f.erasePage()
+		if err != nil {
+			return err
+		}
+
+		for i := ii; i < ii+page; i += 128 {
+			b := 0
+			e := 0
+
+			for w := 0; w < 64; w++ {
+				e = f.pushWriteWord(data[i+w*2:i+w*2+2], e)
+			}
+			_, err := f.devA.write(f.commands[b:e])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadRegion reads back the whole region.
+func (f *Flash) ReadRegion(region Region) ([]byte, error) {
+	mr, ok := f.Device.Region(region)
+	if !ok {
+		return nil, fmt.Errorf("invalid region: %d", region)
+	}
+
+	if region == REGION_FLASH {
+		_, err := f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, f.lenPFM)
+		_, err = io.ReadFull(f, data)
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	err := f.loadAddress(mr.Start)
+	if err != nil {
+		return nil, err
+	}
+	size := int(mr.End - mr.Start)
+	words := make([]byte, size/mr.Unit*2)
+	err = f.readWordsTo(words)
+	if err != nil {
+		return nil, err
+	}
+	if mr.Unit == 2 {
+		return words, nil
+	}
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = words[i*2]
+	}
+	return data, nil
+}
+
+// Verify reads back the region and compares it with data, except for the
+// skipped ranges. Only the implemented configuration bits are compared.
+func (f *Flash) Verify(region Region, data []byte, skip []AddressRange) (err error) {
+	defer f.audit("verify", region, data)(&err)
+	mr, _ := f.Device.Region(region)
+	if len(data) < int(mr.End-mr.Start) {
+		return shortData(len(data), int(mr.End-mr.Start))
+	}
+
+	readBack, err := f.ReadRegion(region)
+	if err != nil {
+		return err
+	}
+
+	mask := make([]byte, len(readBack))
+	for i := range mask {
+		mask[i] = 0xff
+	}
+	if region == REGION_CONFIGURATION {
+		mask = f.Device.ConfigMask()
+	}
+
+	for i, b := range readBack {
+		addr := mr.Start + uint32(i)
+		if (b^data[i])&mask[i] != 0 && !isProtected(addr, skip) {
+			return &VerifyError{Address: addr, Read: b, Expected: data[i]}
+		}
+	}
+	return nil
+}
+
+// VerifyError is returned when the read back data differs.
+type VerifyError struct {
+	Address  uint32
+	Read     byte
+	Expected byte
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s at %06x: read %02x, expected %02x", ErrVerify, e.Address, e.Read, e.Expected)
+}
+
+func (e *VerifyError) Is(target error) bool {
+	return target == ErrVerify
+}
+
+// WriteUserIDs erases the user IDs and programs data.
+func (f *Flash) WriteUserIDs(data []byte) (err error) {
+	defer f.audit("write", REGION_USER_ID, data)(&err)
+	if len(data) < sizeUserID {
+		return shortData(len(data), sizeUserID)
+	}
+
+	err = f.bulkErase(REGION_USER_ID)
+	if err != nil {
+		return err
+	}
+	err = f.loadAddress(addrUserID)
+	if err != nil {
+		return err
+	}
+
+	b := 0
+	e := 0
+	for i := 0; i < sizeUserID; i += 2 {
+		e = f.pushWriteWord(data[i:i+2], e)
+		copy(f.UserIDs[i/2][:], data[i:i+2])
+	}
+	_, err = f.devA.write(f.commands[b:e])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteEEPROM erases the data EEPROM and programs data.
+func (f *Flash) WriteEEPROM(data []byte) (err error) {
+	defer f.audit("write", REGION_DATA_EEPROM, data)(&err)
+	if len(data) < f.Device.EEPROMSize {
+		return shortData(len(data), f.Device.EEPROMSize)
+	}
+
+	err = f.bulkErase(REGION_DATA_EEPROM)
+	if err != nil {
+		return err
+	}
+	err = f.loadAddress(addrEEPROM)
+	if err != nil {
+		return err
+	}
+
+	for ii := 0; ii < f.Device.EEPROMSize; ii += 64 {
+		b := 0
+		e := 0
+
+		for i := ii; i < ii+64 && i < f.Device.EEPROMSize; i++ {
+			e = f.pushWriteByte(data[i], e)
+		}
+		_, err := f.devA.write(f.commands[b:e])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteConfig erases the configuration bytes and programs cfg.
+//
+// Values which may lock out this programmer (see Device.CheckConfig) are
+// refused with a *DangerousConfigError unless allowDangerous is set.
+func (f *Flash) WriteConfig(cfg []byte, allowDangerous bool) (err error) {
+	defer f.audit("write", REGION_CONFIGURATION, cfg)(&err)
+	if len(cfg) != len(f.Configuration) {
+		return fmt.Errorf("%w: configuration must be %d bytes", ErrShortData, len(f.Configuration))
+	}
+	if hazards := f.Device.CheckConfig(cfg); len(hazards) > 0 && !allowDangerous {
+		return &DangerousConfigError{Hazards: hazards}
+	}
+
+	err = f.bulkErase(REGION_CONFIGURATION)
+	if err != nil {
+		return err
+	}
+	err = f.loadAddress(addrConfig)
+	if err != nil {
+		return err
+	}
+
+	b := 0
+	e := 0
+	for _, value8 := range cfg {
+		e = f.pushWriteByte(value8, e)
+	}
+	_, err = f.devA.write(f.commands[b:e])
+	if err != nil {
+		return err
+	}
+
+	copy(f.Configuration[:], cfg)
+	return nil
+}
+
+func isProtected(addr uint32, protected []AddressRange) bool {
+	for _, r := range protected {
+		if r.contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *Flash) WriterInfo() (ftdi.DevType, uint16, uint16) {
 	return f.devA.t, f.devA.venID, f.devA.devID
 }
 
+// WriterSerial returns the USB serial number of the programmer.
+func (f *Flash) WriterSerial() string {
+	return f.serial
+}
+
 func (f *Flash) tryMpsse(dev *device) error {
 	b := 0
 	e := 0
@@ -260,13 +714,13 @@ func (f *Flash) tryMpsse(dev *device) error {
 		return err
 	}
 	if sent != e-b {
-		return fmt.Errorf("failed to write command: 0x%02x", f.commands[b])
+		return fmt.Errorf("%w: failed to write command: 0x%02x", ErrNoMPSSE, f.commands[b])
 	}
 	b++
 	// Check the receive buffer is empty
 	n, err := dev.read(f.commands[e : e+1])
 	if n != 0 || err != nil {
-		return fmt.Errorf("MPSSE receive buffer should be empty: n=%d, err=%w", n, err)
+		return fmt.Errorf("%w: receive buffer should be empty: n=%d, err=%w", ErrNoMPSSE, n, err)
 	}
 
 	// Synchronize the MPSSE
@@ -281,7 +735,7 @@ func (f *Flash) tryMpsse(dev *device) error {
 		return err
 	}
 	if n != 2 || f.commands[e] != 0xfa || f.commands[e+1] != 0xab {
-		return fmt.Errorf("failed to synchronize the MPSSE")
+		return fmt.Errorf("%w: failed to synchronize", ErrNoMPSSE)
 	}
 
 	// Disable loopback
@@ -292,19 +746,20 @@ func (f *Flash) tryMpsse(dev *device) error {
 		return err
 	}
 	if sent != e-b {
-		return fmt.Errorf("failed to write command: 0x%02x", f.commands[b])
+		return fmt.Errorf("%w: failed to write command: 0x%02x", ErrNoMPSSE, f.commands[b])
 	}
 	b++
 	// Check the receive buffer is empty
 	n, err = dev.read(f.commands[e : e+1])
 	if n != 0 || err != nil {
-		return fmt.Errorf("MPSSE receive buffer should be empty: n=%d, err=%w", n, err)
+		return fmt.Errorf("%w: receive buffer should be empty: n=%d, err=%w", ErrNoMPSSE, n, err)
 	}
 
 	return nil
 }
 
-// PIC pins:
+// PIC pins, wired as PinsGPIO (PinsMPSSE moves ICSPCLK to ADBUS0 and
+// ICSPDAT to ADBUS1 and ADBUS2):
 //
 // Channel A:
 // ADBUS0: TCK/SK: OUT (SPI SCLK)
@@ -330,9 +785,18 @@ func (f *Flash) setupPICPins() error {
 	b := 0
 	e := 0
 
-	// clock: master 60_000_000 / ((1+0x000e)*2) [Hz] = 2[MHz]
-	clockDivisorHi := uint8(0x00)
-	clockDivisorLo := uint8(0x0e)
+	// clock: master 60_000_000 / ((1+divisor)*2) [Hz], rounded down. When
+	// bit-banged, a TCK wait holds ICSPCLK high for half a period.
+	perClock := 1
+	if !f.pins.Clocked {
+		perClock = 2
+	}
+	divisor := (masterClockHz/2+f.clockHz*perClock-1)/(f.clockHz*perClock) - 1
+	divisor = max(0, min(divisor, 0xffff))
+	f.tckHz = masterClockHz / 2 / (divisor + 1)
+	f.clockHz = f.tckHz / perClock
+	clockDivisorHi := uint8(divisor >> 8)
+	clockDivisorLo := uint8(divisor & 0xff)
 	f.commands[e] = 0x8a // Use 60MHz master clock
 	e++
 	f.commands[e] = 0x97 // Turn off adaptive clocking
@@ -351,13 +815,8 @@ func (f *Flash) setupPICPins() error {
 	}
 	b = e
 
-	// init pins
-	f.commands[e] = 0x80
-	e++
-	f.commands[e] = 0b1000_0001 // /MCLR:1,   state:0,   ICSPDAT:0,   ICSPCLK:0,   (CS:0,   MISO:0,  MOSI:0,   SCLK:1)
-	e++
-	f.commands[e] = 0b1111_1011 // /MCLR:Out, state:Out, ICSPDAT:Out, ICSPCLK:Out, (CS:Out, MISO:In, MOSI:Out, SCLK:Out)
-	e++
+	// init pins: /MCLR:1, ICSPDAT:0, ICSPCLK:0
+	e = f.pushPins(f.pins.level(true, false, false), f.pins.Dir, e)
 	f.commands[e] = 0x82
 	e++
 	f.commands[e] = 0x00 // state:0
@@ -379,33 +838,26 @@ func (f *Flash) resetPIC() error {
 	e := 0
 
 	// /MCLR low
-	f.commands[e] = 0x80
-	e++
-	f.commands[e] = 0b0000_0001 // /MCLR:0,   state:0,   ICSPDAT:0,   ICSPCLK:0
-	e++
-	f.commands[e] = 0b1111_1011 // /MCLR:Out, state:Out, ICSPDAT:Out, ICSPCLK:Out
-	e++
+	e = f.pushPins(f.pins.level(false, false, false), f.pins.Dir, e)
 	_, err := f.devA.write(f.commands[b:e])
 	if err != nil {
 		return err
 	}
 
-	// T ENTH: 1[msec]
-	e = f.pushDelayMillisecond(10, e)
+	e = f.pushDelayTime(f.timing.ENTH, e)
 	// The key sequence
 	key32 := []byte{'M', 'C', 'H', 'P'}
 	for _, k := range key32 {
 		e = f.pushByte(k, e)
 	}
-	// T ENTH: 1[msec]
-	e = f.pushDelayMillisecond(10, e)
+	e = f.pushDelayTime(f.timing.ENTH, e)
 	_, err = f.devA.write(f.commands[b:e])
 	if err != nil {
 		return err
 	}
 
 	// User IDs (32 Words)
-	err = f.loadAddress(0x20_0000)
+	err = f.loadAddress(addrUserID)
 	if err != nil {
 		return err
 	}
@@ -418,7 +870,7 @@ func (f *Flash) resetPIC() error {
 	}
 
 	// Configuration Bytes (10 Bytes)
-	err = f.loadAddress(0x30_0000)
+	err = f.loadAddress(addrConfig)
 	if err != nil {
 		return err
 	}
@@ -431,7 +883,7 @@ func (f *Flash) resetPIC() error {
 	}
 
 	// Revision ID (1 Word), Device ID (1 Word)
-	err = f.loadAddress(0x3f_fffc)
+	err = f.loadAddress(addrRevision)
 	if err != nil {
 		return err
 	}
@@ -448,6 +900,27 @@ func (f *Flash) resetPIC() error {
 	}
 	f.DeviceID = (uint16(value16[0]) | (uint16(value16[1]) << 8))
 
+	f.Device = lookupDevice(f.DeviceID)
+	if f.Device == nil {
+		return &UnknownDeviceError{DeviceID: f.DeviceID, RevisionID: f.RevisionID}
+	}
+	f.lenPFM = f.Device.PFMSize
+	f.timing = f.Device.Timing.override(f.override)
+
+	// Device Information Area (32 Words)
+	words, err := f.readWords(f.Device.DIAAddr, 32)
+	if err != nil {
+		return err
+	}
+	f.DIA.decode(words)
+
+	// Device Configuration Information (5 Words)
+	words, err = f.readWords(f.Device.DCIAddr, 5)
+	if err != nil {
+		return err
+	}
+	f.DCI.decode(words)
+
 	// reset
 	err = f.loadAddress(0)
 	if err != nil {
@@ -456,128 +929,158 @@ func (f *Flash) resetPIC() error {
 
 	f.posPFM = 0
 
-	switch f.DeviceID {
-	case 0x74A0:
-		f.lenPFM = 0x2_0000
-	default:
-		return errors.New("unknown target device")
-	}
-
 	return nil
 }
 
-// send a byte from MSB
-func (f *Flash) pushByte(data byte, pos int) int {
-	for i := 7; i >= 0; i-- {
-		b := byte((data >> i) & 1)
-
-		f.commands[pos] = 0x80
-		pos++
-		f.commands[pos] = ((b << 5) | 0b0001_0001) // /MCLR:0,   state:0,   ICSPDAT:b,   ICSPCLK:1
-		pos++
-		f.commands[pos] = 0b1111_1011 //              /MCLR:Out, state:Out, ICSPDAT:Out, ICSPCLK:Out
-		pos++
-
-		f.commands[pos] = 0x80
-		pos++
-		f.commands[pos] = ((b << 5) | 0b0000_0001) // /MCLR:0,   state:0,   ICSPDAT:b,   ICSPCLK:0
-		pos++
-		f.commands[pos] = 0b1111_1011 //              /MCLR:Out, state:Out, ICSPDAT:Out, ICSPCLK:Out
-		pos++
+func (f *Flash) readWords(addr uint32, n int) ([]uint16, error) {
+	err := f.loadAddress(addr)
+	if err != nil {
+		return nil, err
 	}
-	return pos
+	data := make([]byte, n*2)
+	err = f.readWordsTo(data)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]uint16, n)
+	for i := range words {
+		words[i] = uint16(data[i*2]) | (uint16(data[i*2+1]) << 8)
+	}
+	return words, nil
 }
 
-// delay (0-7 + 1) clocks
-//
-// 1 clock @ 2[MHz] -> 500 nsec
-func (f *Flash) pushDelay(clk byte, pos int) int {
-	f.commands[pos] = 0x8e // wait
+// set ADBUS levels and directions
+func (f *Flash) pushPins(value, dir byte, pos int) int {
+	f.low, f.lowDir = value, dir
+	f.commands[pos] = 0x80
+	pos++
+	f.commands[pos] = value
 	pos++
-	f.commands[pos] = clk - 1
+	f.commands[pos] = dir
 	pos++
 	return pos
 }
 
-// delay usec (>=2)
+// send a byte from MSB
 //
-// 2 clocks @ 2[MHz] -> 1 usec
-func (f *Flash) pushDelayMicrosecond(usec int, pos int) int {
-	length := (2 * usec * 2 /* margin */) >> 3 // /8: to bytes
+// ICSPDAT changes on the rising edge of ICSPCLK and is latched by the target
+// on the falling edge.
+func (f *Flash) pushByte(data byte, pos int) int {
+	if f.pins.Clocked {
+		f.commands[pos] = 0x10 // clock data bytes out on +ve edge, MSB first
+		pos++
+		f.commands[pos] = 0x00 // length - 1
+		pos++
+		f.commands[pos] = 0x00
+		pos++
+		f.commands[pos] = data
+		pos++
+		return pos
+	}
 
-	f.commands[pos] = 0x8f // wait
-	pos++
-	f.commands[pos] = uint8(length & 0xff)
-	pos++
-	f.commands[pos] = uint8((length >> 8) & 0xff)
-	pos++
+	for i := 7; i >= 0; i-- {
+		b := (data>>i)&1 == 1
+		pos = f.pushPins(f.pins.level(false, b, true), f.pins.Dir, pos)
+		pos = f.pushClocks(1, pos) // TCKH and TDS, before the target latches
+		pos = f.pushPins(f.pins.level(false, b, false), f.pins.Dir, pos)
+	}
 	return pos
 }
 
-// delay msec
+// wait at least d, in TCK clocks
 //
-// 2000 clocks @ 2[MHz] -> 1 msec
-func (f *Flash) pushDelayMillisecond(msec int, pos int) int {
-	length := (2000 * msec * 2 /* margin */) >> 3 // /8: to bytes
+// 0x8f waits (n+1)*8 clocks, 0x8e (n+1) clocks. Both pulse TCK: when it is
+// ICSPCLK, it is released meanwhile and Hold keeps ICSPCLK at its level.
+func (f *Flash) pushWait(d time.Duration, pos int) int {
+	clocks := int((int64(d)*int64(f.tckHz) + int64(time.Second) - 1) / int64(time.Second))
+	if clocks <= 0 {
+		return pos
+	}
+	if !f.pins.Clocked {
+		return f.pushClocks(clocks, pos)
+	}
 
-	f.commands[pos] = 0x8f // wait
-	pos++
-	f.commands[pos] = uint8(length & 0xff)
-	pos++
-	f.commands[pos] = uint8((length >> 8) & 0xff)
-	pos++
-	return pos
+	value, dir := f.low, f.lowDir
+	hold := value &^ f.pins.Hold
+	if value&f.pins.CLK != 0 {
+		hold |= f.pins.Hold
+	}
+	pos = f.pushPins(hold, (dir&^f.pins.CLK)|f.pins.Hold, pos)
+	pos = f.pushClocks(clocks, pos)
+	return f.pushPins(value, dir, pos)
 }
 
-func (f *Flash) pushReadWord(pos int) int {
-	// Read Data from NVM & PC++: 0xfe
-	pos = f.pushByte(0xfe, pos) // +6
-
-	// ICSPDAT: Out -> In // +3
-	{
-		f.commands[pos] = 0x80
+// pulse TCK clocks times
+func (f *Flash) pushClocks(clocks int, pos int) int {
+	for clocks > 8 {
+		n := min(clocks/8, 0x1_0000)
+		f.commands[pos] = 0x8f // wait
 		pos++
-		f.commands[pos] = 0b0000_0001 // /MCLR:0,   state:0,   ICSPDAT:0,   ICSPCLK:0
+		f.commands[pos] = uint8((n - 1) & 0xff)
 		pos++
-		f.commands[pos] = 0b1101_1011 // /MCLR:Out, state:Out, ICSPDAT:In,  ICSPCLK:Out
+		f.commands[pos] = uint8(((n - 1) >> 8) & 0xff)
 		pos++
+		clocks -= n * 8
 	}
-	pos = f.pushDelay(2, pos) // +2
-
-	for i := 23; i >= 0; i-- { // +7/loop
-		// clock: high
-		f.commands[pos] = 0x80
-		pos++
-		f.commands[pos] = 0b0001_0001 // /MCLR:0,   state:0,   ICSPDAT:0,   ICSPCLK:1
+	if clocks > 0 {
+		f.commands[pos] = 0x8e // wait
 		pos++
-		f.commands[pos] = 0b1101_1011 // /MCLR:Out, state:Out, ICSPDAT:In,  ICSPCLK:Out
+		f.commands[pos] = uint8(clocks - 1)
 		pos++
+	}
+	return pos
+}
 
-		// read
-		f.commands[pos] = 0x81
-		pos++
+// delay clk * 500 nsec, i.e. clk clocks @ 2[MHz]
+func (f *Flash) pushDelay(clk byte, pos int) int {
+	return f.pushWait(time.Duration(clk)*500*time.Nanosecond, pos)
+}
+
+// delay d * margin
+func (f *Flash) pushDelayTime(d time.Duration, pos int) int {
+	return f.pushWait(time.Duration(float64(d)*f.timing.Margin), pos)
+}
+
+// read a word from MSB
+//
+// The target drives ICSPDAT on the rising edge of ICSPCLK; it is sampled
+// before the falling edge.
+func (f *Flash) pushReadWord(pos int) int {
+	dirIn := f.pins.Dir &^ f.pins.DAT
+
+	// Read Data from NVM & PC++: 0xfe
+	pos = f.pushByte(0xfe, pos) // +64 or +4
+
+	// ICSPDAT: Out -> In // +3
+	pos = f.pushPins(f.pins.level(false, false, false), dirIn, pos)
+	pos = f.pushDelay(2, pos) // +2 or +8
 
-		// clock: low
-		f.commands[pos] = 0x80
+	if f.pins.Clocked {
+		f.commands[pos] = 0x24 // clock data bytes in on -ve edge, MSB first // +3
 		pos++
-		f.commands[pos] = 0b0000_0001 // /MCLR:0,   state:0,   ICSPDAT:0,   ICSPCLK:0
+		f.commands[pos] = 0x02 // length - 1: 24 bits
 		pos++
-		f.commands[pos] = 0b1101_1011 // /MCLR:Out, state:Out, ICSPDAT:In,  ICSPCLK:Out
+		f.commands[pos] = 0x00
 		pos++
+	} else {
+		for i := 23; i >= 0; i-- { // +9/loop
+			// clock: high
+			pos = f.pushPins(f.pins.level(false, false, true), dirIn, pos)
+			pos = f.pushClocks(1, pos) // TCO
+			// read
+			f.commands[pos] = 0x81
+			pos++
+			// clock: low
+			pos = f.pushPins(f.pins.level(false, false, false), dirIn, pos)
+		}
 	}
 
 	// ICSPDAT: In -> Out // +3
-	{
-		f.commands[pos] = 0x80
-		pos++
-		f.commands[pos] = 0b0000_0001 // /MCLR:0,   state:0,   ICSPDAT:0,   ICSPCLK:0
-		pos++
-		f.commands[pos] = 0b1111_1011 // /MCLR:Out, state:Out, ICSPDAT:Out, ICSPCLK:Out
-		pos++
-	}
-	pos = f.pushDelay(2, pos) // +2
+	pos = f.pushPins(f.pins.level(false, false, false), f.pins.Dir, pos)
+	pos = f.pushDelay(2, pos) // +2 or +8
 
-	// 6+3+2 + 7*24 + 3+2 = 184/16bits
+	// GPIO:    64+3+2 + 9*24 + 3+2 = 290/16bits, 24 bytes back
+	// Clocked:  4+3+8 + 3    + 3+8 =  29/16bits,  3 bytes back
 	return pos
 }
 
@@ -602,8 +1105,7 @@ func (f *Flash) pushWriteWord(value16 []byte, pos int) int {
 	pos = f.pushByte(byte((value7_16_1>>8)&0xff), pos)
 	pos = f.pushByte(byte((value7_16_1>>0)&0xff), pos)
 
-	// T PINT: 75[usec]
-	pos = f.pushDelayMicrosecond(75, pos)
+	pos = f.pushDelayTime(f.timing.PINT, pos)
 
 	return pos
 }
@@ -625,12 +1127,29 @@ func (f *Flash) pushWriteByte(value8 byte, pos int) int {
 	pos = f.pushByte(byte((value15_8_1>>8)&0xff), pos)
 	pos = f.pushByte(byte((value15_8_1>>0)&0xff), pos)
 
-	// T PDFM: 11[msec]
-	pos = f.pushDelayMillisecond(11, pos)
+	pos = f.pushDelayTime(f.timing.PDFM, pos)
 
 	return pos
 }
 
+// erase the page at the current address
+func (f *Flash) erasePage() error {
+	b := 0
+	e := 0
+
+	// Page Erase: 0xf0
+	e = f.pushByte(0xf0, e)
+
+	e = f.pushDelayTime(f.timing.ERAR, e)
+
+	_, err := f.devA.write(f.commands[b:e])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (f *Flash) loadAddress(addr uint32) error {
 	b := 0
 	e := 0
@@ -653,37 +1172,51 @@ func (f *Flash) loadAddress(addr uint32) error {
 	return nil
 }
 
-func (f *Flash) read64Words() ([]byte, error) {
-	b := 0
-	e := 0
-
-	for i := 0; i < 64; i++ {
-		e = f.pushReadWord(e)
-	}
-
-	_, err := f.devA.write(f.commands[b:e])
-	if err != nil {
-		return nil, err
+// readWordsTo reads len(dst)/2 words from the current address into dst.
+//
+// The words are read in batches of readBatch, and the commands of the next
+// batch are sent before the results of the previous one are collected, so the
+// MPSSE is kept busy while the host decodes.
+func (f *Flash) readWordsTo(dst []byte) error {
+	words := len(dst) >> 1
+	inFlight := 0
+	for i := 0; i < words || inFlight > 0; {
+		n := min(readBatch, words-i)
+		if n > 0 {
+			e := 0
+			for w := 0; w < n; w++ {
+				e = f.pushReadWord(e)
+			}
+			_, err := f.devA.write(f.commands[:e])
+			if err != nil {
+				return err
+			}
+		}
+		if inFlight > 0 {
+			err := f.collectWords(dst[(i-inFlight)*2 : i*2])
+			if err != nil {
+				return err
+			}
+		}
+		i += n
+		inFlight = n
 	}
+	return nil
+}
 
-	results24 := f.commands[0 : 24*64]
-	err = f.devA.readAll(results24)
+// collectWords reads back the results of len(dst)/2 pushReadWord.
+func (f *Flash) collectWords(dst []byte) error {
+	n := f.pins.resultLen()
+	results := f.results[:len(dst)/2*n]
+	err := f.devA.readAll(results)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	values := make([]byte, 64*2)
-	for i := 0; i < 64; i++ {
-		// from MSB
-		value16 := uint16(0)
-		for _, b := range results24[24*i+7 : 24*i+7+16] {
-			value16 = ((value16 << 1) | uint16((b&0b0010_0000)>>5))
-		}
-		// swap
-		values[i*2+0] = byte(value16 & 0xff)
-		values[i*2+1] = byte(value16 >> 8)
+	for i := 0; i < len(dst)/2; i++ {
+		value16 := f.pins.decodeWord(results[n*i : n*(i+1)])
+		copy(dst[i*2:], value16[:])
 	}
-	return values, nil
+	return nil
 }
 
 func (f *Flash) readWord() (value16 [2]byte, err error) {
@@ -697,22 +1230,13 @@ func (f *Flash) readWord() (value16 [2]byte, err error) {
 		return value16, err
 	}
 
-	result24 := f.commands[e : e+24]
-	err = f.devA.readAll(result24)
+	result := f.results[:f.pins.resultLen()]
+	err = f.devA.readAll(result)
 	if err != nil {
 		return value16, err
 	}
 
-	// from MSB
-	var u16 uint16
-	for _, b := range result24[7 : 7+16] {
-		u16 = ((u16 << 1) | uint16((b&0b0010_0000)>>5))
-	}
-	// swap
-	value16[0] = byte(u16 & 0xff)
-	value16[1] = byte(u16 >> 8)
-
-	return value16, nil
+	return f.pins.decodeWord(result), nil
 }
 
 func (f *Flash) readByte() (byte, error) {
@@ -62,6 +62,24 @@ func (e *EEPROM) AsFT232R() *EEPROMFT232R {
 	return (*EEPROMFT232R)(unsafe.Pointer(&e.Raw[0]))
 }
 
+// AsFT4232H returns the Raw data aliased as EEPROMFT4232H.
+func (e *EEPROM) AsFT4232H() *EEPROMFT4232H {
+	// sizeof(EEPROMFT4232H)
+	if len(e.Raw) < 36 {
+		return nil
+	}
+	return (*EEPROMFT4232H)(unsafe.Pointer(&e.Raw[0]))
+}
+
+// AsFTX returns the Raw data aliased as EEPROMFTX.
+func (e *EEPROM) AsFTX() *EEPROMFTX {
+	// sizeof(EEPROMFTX)
+	if len(e.Raw) < 56 {
+		return nil
+	}
+	return (*EEPROMFTX)(unsafe.Pointer(&e.Raw[0]))
+}
+
 // FT232hCBusMux is stored in the FT232H EEPROM to control each CBus pin.
 type FT232hCBusMux uint8
 
@@ -159,6 +177,73 @@ func (f FT232rCBusMux) String() string {
 	return ft232rCBusMuxName[ft232rCBusMuxIndex[f]:ft232rCBusMuxIndex[f+1]]
 }
 
+// FTxCBusMux is stored in the FT-X series EEPROM to control each CBus pin.
+type FTxCBusMux uint8
+
+const (
+	// TriSt-PU; Sets in Tristate (pull up) (C0~C6).
+	FTxCBusTristatePullUp FTxCBusMux = 0x00
+	// TXLED#; Pulses low when transmitting data (C0~C6).
+	FTxCBusTxLED FTxCBusMux = 0x01
+	// RXLED#; Pulses low when receiving data (C0~C6).
+	FTxCBusRxLED FTxCBusMux = 0x02
+	// TX&RXLED#; Pulses low when either receiving or transmitting data (C0~C6).
+	FTxCBusTxRxLED FTxCBusMux = 0x03
+	// PWREN#; Output is low after the device has been configured by USB, then
+	// high during USB suspend mode (C0~C6).
+	//
+	// Must be used with an external 10kΩ pull up.
+	FTxCBusPwrEnable FTxCBusMux = 0x04
+	// SLEEP#; Goes low during USB suspend mode (C0~C6).
+	FTxCBusSleep FTxCBusMux = 0x05
+	// DRIVE0; Drives pin to logic 0 (C0~C6).
+	FTxCBusDrive0 FTxCBusMux = 0x06
+	// DRIVE1; Drives pin to logic 1 (C0~C6).
+	FTxCBusDrive1 FTxCBusMux = 0x07
+	// GPIO; CBus bit-bang mode option (C0~C3).
+	FTxCBusIOMode FTxCBusMux = 0x08
+	// TXDEN; Tx Data Enable. Used with RS485 level converters to enable the line
+	// driver during data transmit (C0~C6).
+	FTxCBusTxdEnable FTxCBusMux = 0x09
+	// CLK24 24MHz clock output (C0~C6).
+	FTxCBusClk24 FTxCBusMux = 0x0A
+	// CLK12 12MHz clock output (C0~C6).
+	FTxCBusClk12 FTxCBusMux = 0x0B
+	// CLK6 6MHz clock output (C0~C6).
+	FTxCBusClk6 FTxCBusMux = 0x0C
+	// BCD_Charger; High when a battery charger port is detected (C0~C6).
+	FTxCBusBCDCharger FTxCBusMux = 0x0D
+	// BCD_Charger#; Low when a battery charger port is detected (C0~C6).
+	FTxCBusBCDChargerN FTxCBusMux = 0x0E
+	// I2C_TXE#; Transmit buffer empty, FT200XD and FT201X only (C0~C6).
+	FTxCBusI2CTxE FTxCBusMux = 0x0F
+	// I2C_RXF#; Receive buffer full, FT200XD and FT201X only (C0~C6).
+	FTxCBusI2CRxF FTxCBusMux = 0x10
+	// VBUS_Sense; Input to detect when VBUS is present (C0~C6).
+	FTxCBusVBusSense FTxCBusMux = 0x11
+	// BitBang_WR#; Synchronous and asynchronous bit-bang WR# strobe output
+	// (C0~C6).
+	FTxCBusBitBangWR FTxCBusMux = 0x12
+	// BitBang_RD#; Synchronous and asynchronous bit-bang RD# strobe output
+	// (C0~C6).
+	FTxCBusBitBangRD FTxCBusMux = 0x13
+	// Time_Stamp; Toggles when a USB SOF token is received (C0~C6).
+	FTxCBusTimestamp FTxCBusMux = 0x14
+	// Keep_Awake#; Prevents the chip from going into suspend (C0~C6).
+	FTxCBusKeepAwake FTxCBusMux = 0x15
+)
+
+const ftxCBusMuxName = "FTxCBusTristatePullUpFTxCBusTxLEDFTxCBusRxLEDFTxCBusTxRxLEDFTxCBusPwrEnableFTxCBusSleepFTxCBusDrive0FTxCBusDrive1FTxCBusIOModeFTxCBusTxdEnableFTxCBusClk24FTxCBusClk12FTxCBusClk6FTxCBusBCDChargerFTxCBusBCDChargerNFTxCBusI2CTxEFTxCBusI2CRxFFTxCBusVBusSenseFTxCBusBitBangWRFTxCBusBitBangRDFTxCBusTimestampFTxCBusKeepAwake"
+
+var ftxCBusMuxIndex = [...]uint16{0, 21, 33, 45, 59, 75, 87, 100, 113, 126, 142, 154, 166, 177, 194, 212, 225, 238, 254, 270, 286, 302, 318}
+
+func (f FTxCBusMux) String() string {
+	if f >= FTxCBusMux(len(ftxCBusMuxIndex)-1) {
+		return fmt.Sprintf("FTxCBusMux(%d)", f)
+	}
+	return ftxCBusMuxName[ftxCBusMuxIndex[f]:ftxCBusMuxIndex[f+1]]
+}
+
 // EEPROMHeader is the common header found on FTDI devices.
 //
 // It is 16 bytes long.
@@ -294,6 +379,106 @@ func (e *EEPROMFT232R) Defaults() {
 	e.DriverType = 1
 }
 
+// EEPROMFT4232H is the EEPROM layout of a FT4232H device.
+//
+// It is 36 bytes long.
+type EEPROMFT4232H struct {
+	EEPROMHeader
+
+	// FT4232H specific.
+	ASlowSlew     uint8 // 0x10 bool non-zero if A pins have slow slew
+	ASchmittInput uint8 // 0x11 bool non-zero if A pins are Schmitt input
+	ADriveCurrent uint8 // 0x12 Valid values are 4mA, 8mA, 12mA, 16mA
+	BSlowSlew     uint8 // 0x13 bool non-zero if B pins have slow slew
+	BSchmittInput uint8 // 0x14 bool non-zero if B pins are Schmitt input
+	BDriveCurrent uint8 // 0x15 Valid values are 4mA, 8mA, 12mA, 16mA
+	CSlowSlew     uint8 // 0x16 bool non-zero if C pins have slow slew
+	CSchmittInput uint8 // 0x17 bool non-zero if C pins are Schmitt input
+	CDriveCurrent uint8 // 0x18 Valid values are 4mA, 8mA, 12mA, 16mA
+	DSlowSlew     uint8 // 0x19 bool non-zero if D pins have slow slew
+	DSchmittInput uint8 // 0x1A bool non-zero if D pins are Schmitt input
+	DDriveCurrent uint8 // 0x1B Valid values are 4mA, 8mA, 12mA, 16mA
+	ARIIsTXDEN    uint8 // 0x1C bool non-zero if port A uses RI as RS485 TXDEN
+	BRIIsTXDEN    uint8 // 0x1D bool non-zero if port B uses RI as RS485 TXDEN
+	CRIIsTXDEN    uint8 // 0x1E bool non-zero if port C uses RI as RS485 TXDEN
+	DRIIsTXDEN    uint8 // 0x1F bool non-zero if port D uses RI as RS485 TXDEN
+	ADriverType   uint8 // 0x20 bool 0 is D2XX, 1 is VCP
+	BDriverType   uint8 // 0x21 bool 0 is D2XX, 1 is VCP
+	CDriverType   uint8 // 0x22 bool 0 is D2XX, 1 is VCP
+	DDriverType   uint8 // 0x23 bool 0 is D2XX, 1 is VCP
+}
+
+func (e *EEPROMFT4232H) Defaults() {
+	// As programmed by FTDI.
+	e.ADriveCurrent = 4
+	e.BDriveCurrent = 4
+	e.CDriveCurrent = 4
+	e.DDriveCurrent = 4
+	e.ADriverType = 1
+	e.BDriverType = 1
+	e.CDriverType = 1
+	e.DDriverType = 1
+}
+
+// EEPROMFTX is the EEPROM layout of the FT-X series devices, e.g. FT230X,
+// FT231X or FT234XD.
+//
+// It is 56 bytes long.
+type EEPROMFTX struct {
+	EEPROMHeader
+
+	// FT-X series specific.
+	ACSlowSlew        uint8      // 0x10 bool Non-zero if AC bus pins have slow slew
+	ACSchmittInput    uint8      // 0x11 bool Non-zero if AC bus pins are Schmitt input
+	ACDriveCurrent    uint8      // 0x12 Valid values are 4mA, 8mA, 12mA, 16mA
+	ADSlowSlew        uint8      // 0x13 bool Non-zero if AD bus pins have slow slew
+	ADSchmittInput    uint8      // 0x14 bool Non-zero if AD bus pins are Schmitt input
+	ADDriveCurrent    uint8      // 0x15 Valid values are 4mA, 8mA, 12mA, 16mA
+	Cbus0             FTxCBusMux // 0x16
+	Cbus1             FTxCBusMux // 0x17
+	Cbus2             FTxCBusMux // 0x18
+	Cbus3             FTxCBusMux // 0x19
+	Cbus4             FTxCBusMux // 0x1A
+	Cbus5             FTxCBusMux // 0x1B
+	Cbus6             FTxCBusMux // 0x1C
+	InvertTXD         uint8      // 0x1D bool
+	InvertRXD         uint8      // 0x1E bool
+	InvertRTS         uint8      // 0x1F bool
+	InvertCTS         uint8      // 0x20 bool
+	InvertDTR         uint8      // 0x21 bool
+	InvertDSR         uint8      // 0x22 bool
+	InvertDCD         uint8      // 0x23 bool
+	InvertRI          uint8      // 0x24 bool
+	BCDEnable         uint8      // 0x25 bool Enable Battery Charger Detection
+	BCDForceCbusPWREN uint8      // 0x26 bool Asserts PWREN# on CBus when a charging port is detected
+	BCDDisableSleep   uint8      // 0x27 bool Never go into sleep mode
+	I2CSlaveAddress   uint16     // 0x28
+	Unused2           uint16     // 0x2A For alignment.
+	I2CDeviceID       uint32     // 0x2C
+	I2CDisableSchmitt uint8      // 0x30 bool
+	FT1248Cpol        uint8      // 0x31 bool FT1248 clock polarity - clock idle high (true) or clock idle low (false)
+	FT1248Lsb         uint8      // 0x32 bool FT1248 data is LSB (true), or MSB (false)
+	FT1248FlowControl uint8      // 0x33 bool FT1248 flow control enable
+	RS485EchoSuppress uint8      // 0x34 bool
+	PowerSaveEnable   uint8      // 0x35 bool
+	DriverType        uint8      // 0x36 bool 0 is D2XX, 1 is VCP
+	Unused3           uint8      // 0x37 For alignment.
+}
+
+func (e *EEPROMFTX) Defaults() {
+	// As programmed by FTDI on a FT230X.
+	e.ACDriveCurrent = 4
+	e.ADDriveCurrent = 4
+	e.Cbus0 = FTxCBusTxdEnable
+	e.Cbus1 = FTxCBusRxLED
+	e.Cbus2 = FTxCBusTxLED
+	e.Cbus3 = FTxCBusSleep
+	e.Cbus4 = FTxCBusTristatePullUp
+	e.Cbus5 = FTxCBusTristatePullUp
+	e.Cbus6 = FTxCBusTristatePullUp
+	e.DriverType = 1
+}
+
 //
 
 // DevType is the FTDI device type.
@@ -331,6 +516,12 @@ func (d DevType) EEPROMSize() int {
 	case FT232R:
 		// sizeof(EEPROMFT232R)
 		return 32
+	case FT4232H:
+		// sizeof(EEPROMFT4232H)
+		return 36
+	case FTXSeries:
+		// sizeof(EEPROMFTX)
+		return 56
 	default:
 		return 256
 	}
@@ -0,0 +1,99 @@
+package d2xx
+
+// mpsseHandler receives the MPSSE commands decoded by parseMPSSE.
+type mpsseHandler interface {
+	// setLow sets the levels and directions of ADBUS (0x80).
+	setLow(value, dir byte)
+	// readLow samples ADBUS (0x81).
+	readLow()
+	// setHigh sets the levels and directions of ACBUS (0x82).
+	setHigh(value, dir byte)
+	// readHigh samples ACBUS (0x83).
+	readHigh()
+	// loopback connects TDI to TDO (0x84, 0x85).
+	loopback(on bool)
+	// setDivisor sets the TCK divisor (0x86).
+	setDivisor(divisor int)
+	// wait idles for clocks TCK periods (0x8e, 0x8f).
+	wait(clocks int)
+	// clockOut shifts data out of TDI, MSB first, changing on the rising
+	// edge (0x10).
+	clockOut(data []byte)
+	// clockIn shifts n bytes in from TDO, MSB first, sampled on the falling
+	// edge (0x24).
+	clockIn(n int)
+	// bad is a command the decoder doesn't know, answered with 0xfa cmd.
+	bad(cmd byte)
+}
+
+// parseMPSSE decodes the complete commands at the head of b and returns the
+// number of bytes consumed; an incomplete command is left for the next call.
+//
+// Only the commands used by Flash and the ones without side effects on the
+// target are known.
+func parseMPSSE(b []byte, h mpsseHandler) int {
+	pos := 0
+	for pos < len(b) {
+		cmd := b[pos]
+		args := b[pos+1:]
+		n := 1
+		switch cmd {
+		case 0x80, 0x82:
+			n = 3
+			if len(args) < 2 {
+				return pos
+			}
+			if cmd == 0x80 {
+				h.setLow(args[0], args[1])
+			} else {
+				h.setHigh(args[0], args[1])
+			}
+		case 0x81:
+			h.readLow()
+		case 0x83:
+			h.readHigh()
+		case 0x84, 0x85:
+			h.loopback(cmd == 0x84)
+		case 0x86:
+			n = 3
+			if len(args) < 2 {
+				return pos
+			}
+			h.setDivisor(int(args[0]) | int(args[1])<<8)
+		case 0x87, 0x8a, 0x8b, 0x8c, 0x8d, 0x96, 0x97:
+			// send immediate, clock setup: nothing to simulate
+		case 0x8e:
+			n = 2
+			if len(args) < 1 {
+				return pos
+			}
+			h.wait(int(args[0]) + 1)
+		case 0x8f:
+			n = 3
+			if len(args) < 2 {
+				return pos
+			}
+			h.wait((int(args[0]) | int(args[1])<<8 + 1) * 8)
+		case 0x10:
+			if len(args) < 2 {
+				return pos
+			}
+			length := int(args[0]) | int(args[1])<<8 + 1
+			n = 3 + length
+			if len(args) < 2+length {
+				return pos
+			}
+			h.clockOut(args[2 : 2+length])
+		case 0x24:
+			n = 3
+			if len(args) < 2 {
+				return pos
+			}
+			h.clockIn(int(args[0]) | int(args[1])<<8 + 1)
+		default:
+			h.bad(cmd)
+		}
+		pos += n
+	}
+	return pos
+}
@@ -0,0 +1,118 @@
+package d2xx
+
+import "strings"
+
+// PinMap tells how the target is wired to ADBUS of channel A, and thus how
+// ICSP is driven: by toggling GPIOs one command per edge, or by the MPSSE
+// clocking whole bytes in and out of TDI/TDO.
+type PinMap struct {
+	Name string
+	Desc string
+
+	CLK   byte // ICSPCLK
+	DAT   byte // ICSPDAT driven by the programmer
+	DATIn byte // ICSPDAT sampled by the programmer; DAT itself when bit-banged
+	MCLR  byte // /MCLR
+
+	Dir  byte // pins driven by the programmer, DAT included
+	Idle byte // level of the other driven pins
+
+	// Clocked selects the MPSSE clock data commands. CLK must then be TCK,
+	// DAT TDI and DATIn TDO.
+	Clocked bool
+
+	// Hold is a GPIO tied to ICSPCLK, which holds its level while TCK is
+	// released: the MPSSE waits pulse TCK, which the target would take for
+	// ICSP bits.
+	Hold byte
+}
+
+var (
+	// PinsGPIO bit-bangs ICSP on GPIOL0/1: 8 command bytes per bit written,
+	// and 9 with one sample per bit read. A TCK wait holds each high half of
+	// ICSPCLK, when the target latches or drives ICSPDAT.
+	PinsGPIO = &PinMap{
+		Name:  "gpio",
+		Desc:  "ICSPCLK=ADBUS4, ICSPDAT=ADBUS5, /MCLR=ADBUS7",
+		CLK:   1 << 4,
+		DAT:   1 << 5,
+		DATIn: 1 << 5,
+		MCLR:  1 << 7,
+		Dir:   0b1111_1011,
+		Idle:  0b0000_0001, // SCLK:1
+	}
+
+	// PinsMPSSE clocks ICSP with the MPSSE: ICSPDAT is tied to both TDI and
+	// TDO, and TDI is released while the target drives it. Likewise ICSPCLK
+	// is tied to both TCK and GPIOL0, and TCK is released during the waits.
+	PinsMPSSE = &PinMap{
+		Name:    "mpsse",
+		Desc:    "ICSPCLK=ADBUS0 (TCK) and ADBUS4, ICSPDAT=ADBUS1 (TDI) and ADBUS2 (TDO), /MCLR=ADBUS7",
+		CLK:     1 << 0,
+		DAT:     1 << 1,
+		DATIn:   1 << 2,
+		MCLR:    1 << 7,
+		Dir:     0b1110_1011,
+		Clocked: true,
+		Hold:    1 << 4,
+	}
+)
+
+// PinMaps lists the supported wirings.
+func PinMaps() []*PinMap {
+	return []*PinMap{PinsGPIO, PinsMPSSE}
+}
+
+// PinMapByName returns the pin map named name, or nil.
+func PinMapByName(name string) *PinMap {
+	for _, p := range PinMaps() {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// level returns the ADBUS levels with the given ICSP lines high.
+func (p *PinMap) level(mclr, dat, clk bool) byte {
+	v := p.Idle
+	if mclr {
+		v |= p.MCLR
+	}
+	if dat {
+		v |= p.DAT
+	}
+	if clk {
+		v |= p.CLK
+	}
+	return v
+}
+
+// resultLen is the number of bytes returned per word read.
+func (p *PinMap) resultLen() int {
+	if p.Clocked {
+		return 3
+	}
+	return 24
+}
+
+// decodeWord extracts the word from the 24 bits read by pushReadWord: 7 bits
+// of padding and Start bit, 16 bits from MSB, Stop bit.
+func (p *PinMap) decodeWord(result []byte) (value16 [2]byte) {
+	var u16 uint16
+	if p.Clocked {
+		u24 := (uint32(result[0]) << 16) | (uint32(result[1]) << 8) | uint32(result[2])
+		u16 = uint16(u24 >> 1)
+	} else {
+		for _, b := range result[7 : 7+16] {
+			u16 <<= 1
+			if b&p.DATIn != 0 {
+				u16 |= 1
+			}
+		}
+	}
+	// swap
+	value16[0] = byte(u16 & 0xff)
+	value16[1] = byte(u16 >> 8)
+	return value16
+}
@@ -0,0 +1,530 @@
+package d2xx
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/ysh86/ftPIC/d2xx/ftdi"
+)
+
+// Simulator is an FT2232H with a PIC18 Q-series target attached, which
+// answers the MPSSE commands sent by Flash. Captured sessions are replayed
+// against it, and OpenFlash uses it instead of the hardware when
+// Options.Simulator is set.
+//
+// Only the behavior Flash relies on is simulated: no timing, no write
+// protection, and program operations complete at once. The FT2232H EEPROM
+// starts blank.
+type Simulator struct {
+	Device *Device
+
+	pins *PinMap
+	mem  map[uint32]byte // erased (0xff) when missing
+
+	// FT2232H EEPROM, blank when nil
+	ee *ftdi.EEPROM
+	ua []byte
+
+	// FT2232H
+	low     byte
+	lowDir  byte
+	tdi     bool // last bit clocked out, or the level set
+	loop    bool
+	pending []byte // incomplete command
+	out     []byte // for the host
+
+	// target
+	entered bool   // the key sequence was received
+	key     uint32 // key sequence shift register
+	shift   uint32
+	nbits   int
+	cmd     byte
+	payload bool // cmd waits for its 24-bit payload
+	drive   uint32
+	ndrive  int
+	driving bool // ICSPDAT is driven by the target
+	dat     bool
+	pc      uint32
+
+	// seeding: the reads of memory not programmed yet, with the offset of
+	// their answer in out
+	seeding bool
+	reads   []simRead
+	written map[uint32]bool
+}
+
+type simRead struct {
+	addr uint32
+	out  int
+}
+
+// NewSimulator returns a blank dev wired as PinsGPIO.
+func NewSimulator(dev *Device) *Simulator {
+	s := &Simulator{
+		Device: dev,
+		pins:   PinsGPIO,
+		mem:    map[uint32]byte{},
+	}
+
+	putWord := func(addr uint32, w uint16) {
+		s.mem[addr] = byte(w)
+		s.mem[addr+1] = byte(w >> 8)
+	}
+	putWord(addrRevision, 0xa042) // B2
+	putWord(addrRevision+2, dev.ID)
+	for i := uint32(0); i < 9; i++ {
+		putWord(dev.DIAAddr+i*2, 0x5100+uint16(i)) // MUI
+	}
+	putWord(dev.DCIAddr+0, uint16(dev.PageSize/2))
+	putWord(dev.DCIAddr+2, uint16(dev.PageSize/2))
+	putWord(dev.DCIAddr+4, uint16(dev.PFMSize/dev.PageSize))
+	putWord(dev.DCIAddr+6, uint16(dev.EEPROMSize))
+	putWord(dev.DCIAddr+8, uint16(dev.Pins))
+	return s
+}
+
+// Peek returns n bytes of the target memory at addr.
+func (s *Simulator) Peek(addr uint32, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = s.read(addr + uint32(i))
+	}
+	return data
+}
+
+// Poke sets the target memory at addr, as if programmed.
+func (s *Simulator) Poke(addr uint32, data []byte) {
+	for i, b := range data {
+		s.mem[addr+uint32(i)] = b
+	}
+}
+
+func (s *Simulator) read(addr uint32) byte {
+	if b, ok := s.mem[addr]; ok {
+		return b
+	}
+	return 0xff
+}
+
+func (s *Simulator) open(i int) (d2xxHandle, int) {
+	if i != 0 {
+		return nil, 2 // FT_DEVICE_NOT_FOUND
+	}
+	return s, 0
+}
+
+// target memory
+
+func (s *Simulator) region(addr uint32) (MemoryRegion, bool) {
+	for _, mr := range s.Device.Regions() {
+		if mr.contains(addr) {
+			return mr, true
+		}
+	}
+	return MemoryRegion{}, false
+}
+
+// step is the PC increment at addr: bytes for the data EEPROM and the
+// configuration, words elsewhere.
+func (s *Simulator) step(addr uint32) uint32 {
+	if mr, ok := s.region(addr); ok && mr.Unit == 1 {
+		return 1
+	}
+	return 2
+}
+
+func (s *Simulator) readAt(addr uint32) uint16 {
+	if s.step(addr) == 1 {
+		return uint16(s.read(addr))
+	}
+	return uint16(s.read(addr)) | uint16(s.read(addr+1))<<8
+}
+
+func (s *Simulator) program(addr uint32, value16 uint16) {
+	if _, ok := s.region(addr); !ok {
+		return
+	}
+	if s.seeding {
+		s.written[addr] = true
+		s.written[addr+s.step(addr)-1] = true
+	}
+	if s.step(addr) == 1 {
+		s.mem[addr] = byte(value16)
+		return
+	}
+	// flash cells only go from 1 to 0
+	s.mem[addr] = s.read(addr) & byte(value16)
+	s.mem[addr+1] = s.read(addr+1) & byte(value16>>8)
+}
+
+func (s *Simulator) erase(r AddressRange) {
+	for addr := r.Start; addr < r.End; addr++ {
+		delete(s.mem, addr)
+		if s.seeding {
+			s.written[addr] = true
+		}
+	}
+}
+
+// seed pokes the words which the capture read before programming them. The
+// capture is run on a scratch copy first, to find the addresses read.
+func (s *Simulator) seed(records []CaptureRecord) error {
+	scratch := &Simulator{
+		Device:  s.Device,
+		pins:    s.pins,
+		mem:     maps.Clone(s.mem),
+		seeding: true,
+		written: map[uint32]bool{},
+	}
+	var answers []byte
+	for i, rec := range records {
+		data, err := rec.Bytes()
+		if err != nil {
+			return fmt.Errorf("capture line %d: %w", i+1, err)
+		}
+		switch rec.Op {
+		case "open":
+			scratch.pins = PinMapByName(rec.Pins)
+			if scratch.pins == nil {
+				return fmt.Errorf("capture line %d: unknown pin map: %s", i+1, rec.Pins)
+			}
+		case "write":
+			// out keeps growing, so the offsets of reads hold
+			scratch.d2xxWrite(data)
+		case "read":
+			answers = append(answers, data...)
+		}
+	}
+
+	seeded := map[uint32]bool{}
+	n := scratch.pins.resultLen()
+	for _, r := range scratch.reads {
+		if seeded[r.addr] || r.out+n > len(answers) {
+			continue
+		}
+		seeded[r.addr] = true
+		value16 := scratch.pins.decodeWord(answers[r.out : r.out+n])
+		s.Poke(r.addr, value16[:s.step(r.addr)])
+	}
+	return nil
+}
+
+// ICSP
+
+func (s *Simulator) mclr() bool {
+	return s.low&s.pins.MCLR != 0
+}
+
+// rx receives a bit from the programmer.
+func (s *Simulator) rx(bit bool) {
+	if s.mclr() || s.driving {
+		return
+	}
+	b := uint32(0)
+	if bit {
+		b = 1
+	}
+	if !s.entered {
+		s.key = s.key<<1 | b
+		if s.key == 0x4d43_4850 { // MCHP
+			s.entered = true
+		}
+		return
+	}
+
+	s.shift = s.shift<<1 | b
+	s.nbits++
+	if !s.payload && s.nbits == 8 {
+		s.command(byte(s.shift))
+	} else if s.payload && s.nbits == 24 {
+		s.execute(s.shift & 0xff_ffff)
+	}
+}
+
+// tx sends a bit to the programmer.
+func (s *Simulator) tx() bool {
+	if !s.driving {
+		return false
+	}
+	s.ndrive--
+	return (s.drive>>s.ndrive)&1 == 1
+}
+
+func (s *Simulator) command(cmd byte) {
+	s.cmd = cmd
+	s.shift = 0
+	s.nbits = 0
+	switch cmd {
+	case 0x80, 0x18, 0xe0, 0xc0: // Load PC, Bulk Erase, Program (& PC++)
+		s.payload = true
+	case 0xf0: // Page Erase
+		if s.pc < uint32(s.Device.PFMSize) {
+			page := s.pc &^ uint32(s.Device.PageSize-1)
+			s.erase(AddressRange{page, page + uint32(s.Device.PageSize)})
+		}
+	case 0xf8: // Increment Address
+		s.pc += s.step(s.pc)
+	case 0xfc, 0xfe: // Read Data (& PC++)
+		if s.seeding && !s.written[s.pc] {
+			s.reads = append(s.reads, simRead{s.pc, len(s.out)})
+		}
+		s.drive = uint32(s.readAt(s.pc)) << 1 // 0:Start bit, 16:value, 0:Stop bit
+		s.ndrive = 24
+		s.driving = true
+		if cmd == 0xfe {
+			s.pc += s.step(s.pc)
+		}
+	}
+}
+
+func (s *Simulator) execute(payload uint32) {
+	s.payload = false
+	s.shift = 0
+	s.nbits = 0
+	switch s.cmd {
+	case 0x80:
+		s.pc = (payload >> 1) & 0x3f_ffff
+	case 0x18:
+		regions := Region((payload >> 1) & 0xf)
+		for _, mr := range s.Device.Regions() {
+			if regions&mr.Region != 0 {
+				s.erase(mr.AddressRange)
+			}
+		}
+	case 0xe0, 0xc0:
+		s.program(s.pc, uint16(payload>>1))
+		if s.cmd == 0xe0 {
+			s.pc += s.step(s.pc)
+		}
+	}
+}
+
+// mpsseHandler
+
+func (s *Simulator) setLow(value, dir byte) {
+	oldMCLR, oldCLK := s.mclr(), s.low&s.pins.CLK != 0
+	s.low, s.lowDir = value, dir
+	s.tdi = value&s.pins.DAT != 0
+
+	if oldMCLR != s.mclr() {
+		// entering or leaving the programming mode
+		s.entered = false
+		s.key = 0
+		s.shift = 0
+		s.nbits = 0
+		s.payload = false
+		s.driving = false
+	}
+	if s.pins.Clocked {
+		return
+	}
+
+	clk := s.low&s.pins.CLK != 0
+	switch {
+	case !oldCLK && clk:
+		s.dat = s.tx()
+	case oldCLK && !clk:
+		if s.driving {
+			// the stop bit was sampled: the programmer drives again
+			s.driving = s.ndrive > 0
+			return
+		}
+		s.rx(s.low&s.pins.DAT != 0)
+	}
+}
+
+func (s *Simulator) readLow() {
+	v := s.low & s.lowDir
+	if s.lowDir&s.pins.DATIn == 0 && s.driving && s.dat {
+		v |= s.pins.DATIn
+	}
+	s.out = append(s.out, v)
+}
+
+func (s *Simulator) setHigh(value, dir byte) {}
+
+func (s *Simulator) readHigh() {
+	s.out = append(s.out, 0)
+}
+
+func (s *Simulator) loopback(on bool) {
+	s.loop = on
+}
+
+func (s *Simulator) setDivisor(divisor int) {}
+
+// wait pulses TCK, which reaches the target only if it is ICSPCLK and driven.
+func (s *Simulator) wait(clocks int) {
+	if s.loop || !s.pins.Clocked || s.lowDir&s.pins.CLK == 0 {
+		return
+	}
+	for ; clocks > 0; clocks-- {
+		if s.driving {
+			s.tx()
+			s.driving = s.ndrive > 0
+			continue
+		}
+		s.rx(s.tdi)
+	}
+}
+
+func (s *Simulator) clockOut(data []byte) {
+	if s.loop || !s.pins.Clocked {
+		return
+	}
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			s.tdi = (b>>i)&1 == 1
+			s.rx(s.tdi)
+		}
+	}
+}
+
+func (s *Simulator) clockIn(n int) {
+	for ; n > 0; n-- {
+		var b byte
+		for i := 7; i >= 0; i-- {
+			if s.pins.Clocked && s.tx() {
+				b |= 1 << i
+			}
+			if s.driving && s.ndrive == 0 {
+				s.driving = false
+			}
+		}
+		s.out = append(s.out, b)
+	}
+}
+
+func (s *Simulator) bad(cmd byte) {
+	s.out = append(s.out, 0xfa, cmd)
+}
+
+// d2xxHandle
+
+func (s *Simulator) d2xxClose() int {
+	return 0
+}
+
+func (s *Simulator) d2xxResetDevice() int {
+	s.pending = nil
+	s.out = nil
+	return 0
+}
+
+func (s *Simulator) d2xxGetDeviceInfo() (ftdi.DevType, uint16, uint16, string, int) {
+	return ftdi.FT2232H, 0x0403, 0x6010, "SIM00001", 0
+}
+
+func (s *Simulator) d2xxEEPROMRead(d ftdi.DevType, e *ftdi.EEPROM) int {
+	if s.ee == nil {
+		return 15 // FT_EEPROM_NOT_PROGRAMMED
+	}
+	e.Raw = append(e.Raw[:0], s.ee.Raw...)
+	e.Manufacturer = s.ee.Manufacturer
+	e.ManufacturerID = s.ee.ManufacturerID
+	e.Desc = s.ee.Desc
+	e.Serial = s.ee.Serial
+	return 0
+}
+
+func (s *Simulator) d2xxEEPROMProgram(e *ftdi.EEPROM) int {
+	ee := *e
+	ee.Raw = append([]byte(nil), e.Raw...)
+	s.ee = &ee
+
+	// the strings and the user area share 128 bytes of the 93C56
+	n := max(0, 128-2*(len(e.Manufacturer)+len(e.ManufacturerID)+len(e.Desc)+len(e.Serial)))
+	ua := make([]byte, n)
+	copy(ua, s.ua)
+	s.ua = ua
+	return 0
+}
+
+func (s *Simulator) d2xxEraseEE() int {
+	s.ee = nil
+	s.ua = nil
+	return 0
+}
+
+func (s *Simulator) d2xxWriteEE(offset uint8, value uint16) int {
+	return 14 // FT_EEPROM_NOT_PRESENT
+}
+
+func (s *Simulator) d2xxEEUASize() (int, int) {
+	return len(s.ua), 0
+}
+
+func (s *Simulator) d2xxEEUARead(ua []byte) int {
+	if len(ua) > len(s.ua) {
+		return 6 // FT_INVALID_PARAMETER
+	}
+	copy(ua, s.ua)
+	return 0
+}
+
+func (s *Simulator) d2xxEEUAWrite(ua []byte) int {
+	if len(ua) > len(s.ua) {
+		return 6 // FT_INVALID_PARAMETER
+	}
+	copy(s.ua, ua)
+	return 0
+}
+
+func (s *Simulator) d2xxSetChars(eventChar byte, eventEn bool, errorChar byte, errorEn bool) int {
+	return 0
+}
+
+func (s *Simulator) d2xxSetUSBParameters(in, out int) int {
+	return 0
+}
+
+func (s *Simulator) d2xxSetFlowControl(rtsCts bool) int {
+	return 0
+}
+
+func (s *Simulator) d2xxSetTimeouts(readMS, writeMS int) int {
+	return 0
+}
+
+func (s *Simulator) d2xxSetLatencyTimer(delayMS uint8) int {
+	return 0
+}
+
+func (s *Simulator) d2xxSetBaudRate(hz uint32) int {
+	return 0
+}
+
+func (s *Simulator) d2xxGetQueueStatus() (uint32, int) {
+	return uint32(len(s.out)), 0
+}
+
+// d2xxWaitRx returns at once: the answers are queued as soon as written.
+func (s *Simulator) d2xxWaitRx(timeout time.Duration) (uint32, int) {
+	return uint32(len(s.out)), 0
+}
+
+func (s *Simulator) d2xxRead(b []byte) (int, int) {
+	n := copy(b, s.out)
+	s.out = s.out[n:]
+	return n, 0
+}
+
+func (s *Simulator) d2xxWrite(b []byte) (int, int) {
+	s.pending = append(s.pending, b...)
+	n := parseMPSSE(s.pending, s)
+	s.pending = s.pending[n:]
+	return len(b), 0
+}
+
+func (s *Simulator) d2xxGetBitMode() (byte, int) {
+	return s.low, 0
+}
+
+func (s *Simulator) d2xxSetBitMode(mask, mode byte) int {
+	if bitMode(mode) == bitModeReset {
+		s.pending = nil
+		s.loop = false
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package d2xx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timing holds the programming delays of a device, named after its
+// programming specification. Every delay is multiplied by Margin.
+type Timing struct {
+	ENTH time.Duration // /MCLR low to key sequence, key sequence to first command
+	ERAB time.Duration // bulk erase
+	ERAR time.Duration // page erase
+	PINT time.Duration // program a PFM or user ID word
+	PDFM time.Duration // program a data EEPROM or configuration byte
+
+	Margin float64
+}
+
+// timingQ43 holds the timings of the PIC18F27/47/57Q43.
+var timingQ43 = Timing{
+	ENTH: 10 * time.Millisecond,
+	ERAB: 11 * time.Millisecond,
+	ERAR: 11 * time.Millisecond,
+	PINT: 75 * time.Microsecond,
+	PDFM: 11 * time.Millisecond,
+
+	Margin: 2,
+}
+
+// defaultTiming is used until the target is identified.
+var defaultTiming = timingQ43
+
+func (t *Timing) fields() []struct {
+	name string
+	d    *time.Duration
+} {
+	return []struct {
+		name string
+		d    *time.Duration
+	}{
+		{"ENTH", &t.ENTH},
+		{"ERAB", &t.ERAB},
+		{"ERAR", &t.ERAR},
+		{"PINT", &t.PINT},
+		{"PDFM", &t.PDFM},
+	}
+}
+
+// Set sets the delay named name, e.g. "PINT" to "100us", or the margin,
+// "Margin" to "1.5".
+func (t *Timing) Set(name, value string) error {
+	if strings.EqualFold(name, "Margin") {
+		m, err := strconv.ParseFloat(value, 64)
+		if err != nil || m <= 0 {
+			return fmt.Errorf("invalid margin: %s", value)
+		}
+		t.Margin = m
+		return nil
+	}
+	for _, f := range t.fields() {
+		if strings.EqualFold(f.name, name) {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid %s: %s", f.name, value)
+			}
+			*f.d = d
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown timing: %s", name)
+}
+
+// override returns t with the non-zero values of o.
+func (t Timing) override(o Timing) Timing {
+	for i, f := range o.fields() {
+		if *f.d != 0 {
+			*t.fields()[i].d = *f.d
+		}
+	}
+	if o.Margin != 0 {
+		t.Margin = o.Margin
+	}
+	return t
+}
+
+func (t Timing) String() string {
+	var s []string
+	for _, f := range t.fields() {
+		s = append(s, fmt.Sprintf("%s=%s", f.name, *f.d))
+	}
+	s = append(s, fmt.Sprintf("Margin=%g", t.Margin))
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,320 @@
+package d2xx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteVCD converts a capture to a Value Change Dump of ICSPCLK, ICSPDAT
+// and /MCLR, which GTKWave or PulseView can open. The ICSP commands are
+// decoded into the cmd and value signals: value is the payload of a command,
+// or the word read back.
+//
+// The time is derived from the MPSSE clock divisor: waits and clocked bits
+// are exact, while each GPIO command is assumed to take one clock period. The
+// edges of bit-banged pins are thus nominal, which the header states too.
+func WriteVCD(w io.Writer, records []CaptureRecord) error {
+	// until the capture sets it, the divisor of DefaultClockHz
+	v := &vcdWriter{w: bufio.NewWriter(w), divisor: masterClockHz/2/DefaultClockHz - 1, last: -1}
+
+	// the reads answer the commands in order
+	var writes [][]byte
+	for _, rec := range records {
+		data, err := rec.Bytes()
+		if err != nil {
+			return err
+		}
+		switch rec.Op {
+		case "open":
+			v.pins = PinMapByName(rec.Pins)
+		case "write":
+			writes = append(writes, data)
+		case "read":
+			v.reads = append(v.reads, data...)
+		}
+	}
+	if v.pins == nil {
+		return fmt.Errorf("capture: no pin map")
+	}
+
+	v.header()
+	var pending []byte
+	for _, data := range writes {
+		pending = append(pending, data...)
+		n := parseMPSSE(pending, v)
+		pending = pending[n:]
+	}
+	v.advance(v.period())
+	v.emit()
+	return v.w.Flush()
+}
+
+// VCD identifiers
+const (
+	vcdCLK   = "!"
+	vcdDAT   = "\""
+	vcdMCLR  = "#"
+	vcdCmd   = "$"
+	vcdValue = "%"
+)
+
+type vcdWriter struct {
+	w     *bufio.Writer
+	pins  *PinMap
+	reads []byte
+
+	divisor int
+	ticks   int64 // 60 MHz master clock periods
+	last    int64 // time written, in ps
+	low     byte
+	lowDir  byte
+	tdi     bool // last bit clocked out, or the level set
+	changes []string
+
+	icsp icspDecoder
+}
+
+func (v *vcdWriter) header() {
+	fmt.Fprintln(v.w, "$version ftPIC $end")
+	fmt.Fprintln(v.w, "$comment cmd: ICSP command, e.g. 80 Load PC, 18 Bulk Erase, F0 Page Erase, FE Read & PC++, F8 Increment, E0 Program & PC++;",
+		"value: its payload without Start/Stop bits, or the data read $end")
+	fmt.Fprintln(v.w, "$comment timing: waits and clocked bits are exact; each GPIO command is drawn one TCK period long,",
+		"so bit-banged edges, as with -pins gpio, are nominal $end")
+	fmt.Fprintln(v.w, "$timescale 1ps $end")
+	fmt.Fprintln(v.w, "$scope module icsp $end")
+	fmt.Fprintf(v.w, "$var wire 1 %s ICSPCLK $end\n", vcdCLK)
+	fmt.Fprintf(v.w, "$var wire 1 %s ICSPDAT $end\n", vcdDAT)
+	fmt.Fprintf(v.w, "$var wire 1 %s MCLR $end\n", vcdMCLR)
+	fmt.Fprintf(v.w, "$var wire 8 %s cmd $end\n", vcdCmd)
+	fmt.Fprintf(v.w, "$var wire 24 %s value $end\n", vcdValue)
+	fmt.Fprintln(v.w, "$upscope $end")
+	fmt.Fprintln(v.w, "$enddefinitions $end")
+	v.changes = append(v.changes, "x"+vcdCLK, "x"+vcdDAT, "x"+vcdMCLR, "bx "+vcdCmd, "bx "+vcdValue)
+}
+
+// period is the TCK period in master clock ticks.
+func (v *vcdWriter) period() int64 {
+	return int64(v.divisor+1) * 2
+}
+
+// advance moves the time forward, writing the changes made so far.
+func (v *vcdWriter) advance(ticks int64) {
+	v.emit()
+	v.ticks += ticks
+}
+
+func (v *vcdWriter) emit() {
+	if len(v.changes) == 0 {
+		return
+	}
+	ps := v.ticks * 50_000 / 3
+	if ps != v.last {
+		fmt.Fprintf(v.w, "#%d\n", ps)
+		v.last = ps
+	}
+	for _, c := range v.changes {
+		fmt.Fprintln(v.w, c)
+	}
+	v.changes = v.changes[:0]
+}
+
+func (v *vcdWriter) wire(id string, level bool) {
+	if level {
+		v.changes = append(v.changes, "1"+id)
+	} else {
+		v.changes = append(v.changes, "0"+id)
+	}
+}
+
+func (v *vcdWriter) vector(id string, value uint32) {
+	v.changes = append(v.changes, fmt.Sprintf("b%b %s", value, id))
+}
+
+// read takes the next byte answered by the MPSSE.
+func (v *vcdWriter) read() byte {
+	if len(v.reads) == 0 {
+		return 0
+	}
+	b := v.reads[0]
+	v.reads = v.reads[1:]
+	return b
+}
+
+func (v *vcdWriter) decoded(cmd *byte, value *uint32) {
+	if cmd != nil {
+		v.vector(vcdCmd, uint32(*cmd))
+	}
+	if value != nil {
+		v.vector(vcdValue, *value)
+	}
+}
+
+// mpsseHandler
+
+func (v *vcdWriter) setLow(value, dir byte) {
+	old, oldDir := v.low, v.lowDir
+	v.low, v.lowDir = value, dir
+	v.tdi = value&v.pins.DAT != 0
+	changed := old ^ value
+
+	if changed&v.pins.MCLR != 0 {
+		v.wire(vcdMCLR, value&v.pins.MCLR != 0)
+		v.icsp.reset()
+	}
+	if (changed|(oldDir^dir))&v.pins.DAT != 0 && dir&v.pins.DAT != 0 {
+		v.wire(vcdDAT, value&v.pins.DAT != 0)
+	}
+	if !v.pins.Clocked && changed&v.pins.CLK != 0 {
+		clk := value&v.pins.CLK != 0
+		v.wire(vcdCLK, clk)
+		if !clk && dir&v.pins.DAT != 0 {
+			v.decoded(v.icsp.hostBit(value&v.pins.DAT != 0))
+		}
+	}
+	v.advance(v.period())
+}
+
+func (v *vcdWriter) readLow() {
+	b := v.read()
+	if v.lowDir&v.pins.DAT == 0 && !v.pins.Clocked {
+		bit := b&v.pins.DATIn != 0
+		v.wire(vcdDAT, bit)
+		v.decoded(v.icsp.targetBit(bit))
+	}
+	v.advance(v.period())
+}
+
+func (v *vcdWriter) setHigh(value, dir byte) {
+	v.advance(v.period())
+}
+
+func (v *vcdWriter) readHigh() {
+	v.read()
+	v.advance(v.period())
+}
+
+func (v *vcdWriter) loopback(on bool) {}
+
+func (v *vcdWriter) setDivisor(divisor int) {
+	v.divisor = divisor
+}
+
+// wait pulses TCK, which shows on ICSPCLK only if TCK drives it.
+func (v *vcdWriter) wait(clocks int) {
+	if !v.pins.Clocked || v.lowDir&v.pins.CLK == 0 {
+		v.advance(int64(clocks) * v.period())
+		return
+	}
+	for ; clocks > 0; clocks-- {
+		v.clockBit(v.tdi, true)
+	}
+}
+
+func (v *vcdWriter) clockBit(bit bool, host bool) {
+	if v.pins.Clocked {
+		v.wire(vcdCLK, true)
+		v.wire(vcdDAT, bit)
+	}
+	v.advance(v.period() / 2)
+	if v.pins.Clocked {
+		v.wire(vcdCLK, false)
+		if host {
+			v.decoded(v.icsp.hostBit(bit))
+		} else {
+			v.decoded(v.icsp.targetBit(bit))
+		}
+	}
+	v.advance(v.period() - v.period()/2)
+}
+
+func (v *vcdWriter) clockOut(data []byte) {
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			v.tdi = (b>>i)&1 == 1
+			v.clockBit(v.tdi, true)
+		}
+	}
+}
+
+func (v *vcdWriter) clockIn(n int) {
+	for ; n > 0; n-- {
+		b := v.read()
+		for i := 7; i >= 0; i-- {
+			v.clockBit((b>>i)&1 == 1, false)
+		}
+	}
+}
+
+func (v *vcdWriter) bad(cmd byte) {
+	v.read()
+	v.read()
+}
+
+// icspDecoder follows the ICSP bit stream to annotate it.
+type icspDecoder struct {
+	entered bool
+	key     uint32
+	shift   uint32
+	nbits   int
+	payload bool // 24 bits from the programmer expected
+	reading bool // 24 bits from the target expected
+}
+
+func (d *icspDecoder) reset() {
+	*d = icspDecoder{}
+}
+
+// hostBit takes a bit latched by the target and returns the command or the
+// payload once complete.
+func (d *icspDecoder) hostBit(bit bool) (*byte, *uint32) {
+	b := uint32(0)
+	if bit {
+		b = 1
+	}
+	if !d.entered {
+		d.key = d.key<<1 | b
+		d.entered = d.key == 0x4d43_4850 // MCHP
+		return nil, nil
+	}
+	d.shift = d.shift<<1 | b
+	d.nbits++
+	if d.payload && d.nbits == 24 {
+		value := (d.shift >> 1) & 0x3f_ffff
+		d.payload = false
+		d.shift, d.nbits = 0, 0
+		return nil, &value
+	}
+	if !d.payload && d.nbits == 8 {
+		cmd := byte(d.shift)
+		d.shift, d.nbits = 0, 0
+		switch cmd {
+		case 0x80, 0x18, 0xe0, 0xc0:
+			d.payload = true
+		case 0xfc, 0xfe:
+			d.reading = true
+		}
+		return &cmd, nil
+	}
+	return nil, nil
+}
+
+// targetBit takes a bit sent by the target and returns the data once
+// complete.
+func (d *icspDecoder) targetBit(bit bool) (*byte, *uint32) {
+	if !d.reading {
+		return nil, nil
+	}
+	d.shift <<= 1
+	if bit {
+		d.shift |= 1
+	}
+	d.nbits++
+	if d.nbits < 24 {
+		return nil, nil
+	}
+	value := (d.shift >> 1) & 0xffff
+	d.reading = false
+	d.shift, d.nbits = 0, 0
+	return nil, &value
+}
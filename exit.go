@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// Exit codes; the first failure of the run decides.
+const (
+	exitOK            = 0
+	exitError         = 1 // any other failure
+	exitUsage         = 2 // same as the flag package
+	exitDriver        = 3 // D2XX library not available
+	exitNoProgrammer  = 4 // no FT2232H found, no MPSSE, or it stopped answering
+	exitBusy          = 5 // FT2232H opened by someone else
+	exitNoTarget      = 6 // target not connected or not powered
+	exitUnknownTarget = 7 // unsupported device ID
+	exitVerify        = 8 // read back data differs
+	exitDangerous     = 9 // configuration refused, see -force
+)
+
+var exitStatus = exitOK
+
+// usageError is a mistake on the command line.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, d2xx.ErrDriverMissing):
+		return exitDriver
+	case errors.Is(err, d2xx.ErrDeviceNotFound), errors.Is(err, d2xx.ErrTimeout), errors.Is(err, d2xx.ErrNoMPSSE):
+		return exitNoProgrammer
+	case errors.Is(err, d2xx.ErrDeviceBusy):
+		return exitBusy
+	case errors.Is(err, d2xx.ErrTargetNotResponding):
+		return exitNoTarget
+	case errors.Is(err, d2xx.ErrUnknownDevice):
+		return exitUnknownTarget
+	case errors.Is(err, d2xx.ErrVerify):
+		return exitVerify
+	case errors.Is(err, d2xx.ErrDangerousConfig):
+		return exitDangerous
+	}
+	return exitError
+}
+
+// fail prints err to stderr and records its exit code unless an earlier
+// failure did.
+func fail(prefix string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", prefix, err)
+	if exitStatus == exitOK {
+		exitStatus = exitCode(err)
+	}
+}
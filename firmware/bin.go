@@ -0,0 +1,42 @@
+package firmware
+
+import "io"
+
+// Binary is the raw binary format, loaded at a base address.
+var Binary = &Format{
+	Name:  "bin",
+	Exts:  []string{".bin"},
+	Read:  readBinary,
+	Write: writeBinary,
+}
+
+func init() {
+	Register(Binary)
+}
+
+func readBinary(r io.Reader, base uint32) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m := New()
+	err = m.Add(base, data)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// writeBinary writes from opts.Start to the end of the data.
+func writeBinary(w io.Writer, m *Image, opts *WriteOptions) error {
+	segments := m.Segments()
+	if len(segments) == 0 {
+		return nil
+	}
+	end := segments[len(segments)-1].End()
+	if end < opts.Start {
+		return nil
+	}
+	_, err := w.Write(m.Slice(opts.Start, end, opts.Fill))
+	return err
+}
@@ -0,0 +1,80 @@
+package firmware
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+)
+
+// ELF is the ELF format as produced by the XC8 and Clang linkers.
+//
+// The data is taken from the loadable segments, at their physical address,
+// or from the allocated sections when there is no program header.
+var ELF = &Format{
+	Name: "elf",
+	Exts: []string{".elf"},
+	Read: readELF,
+}
+
+func init() {
+	Register(ELF)
+}
+
+func readELF(r io.Reader, _ uint32) (*Image, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := elf.NewFile(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := New()
+	loaded := false
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || p.Filesz == 0 {
+			continue
+		}
+		data := make([]byte, p.Filesz)
+		_, err := p.ReadAt(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = m.Add(uint32(p.Paddr), data)
+		if err != nil {
+			return nil, err
+		}
+		loaded = true
+	}
+	if !loaded {
+		for _, s := range f.Sections {
+			if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_ALLOC == 0 || s.Size == 0 {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			err = m.Add(uint32(s.Addr), data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	symbols, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	for _, s := range symbols {
+		t := elf.ST_TYPE(s.Info)
+		if s.Section == elf.SHN_UNDEF || s.Name == "" || (t != elf.STT_FUNC && t != elf.STT_OBJECT && t != elf.STT_NOTYPE) {
+			continue
+		}
+		m.Symbols = append(m.Symbols, Symbol{Name: s.Name, Address: uint32(s.Value), Size: uint32(s.Size)})
+	}
+
+	return m, nil
+}
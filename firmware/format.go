@@ -0,0 +1,123 @@
+package firmware
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a file format of memory images.
+type Format struct {
+	Name string
+	Exts []string // lower case, with the leading dot
+
+	// Read parses an image. base is the load address for formats without
+	// addresses.
+	Read func(r io.Reader, base uint32) (*Image, error)
+
+	// Write serializes an image. It is nil if the format is read only.
+	Write func(w io.Writer, m *Image, opts *WriteOptions) error
+}
+
+// WriteOptions controls how images are written.
+type WriteOptions struct {
+	// RecordLen is the number of data bytes per record of text formats.
+	RecordLen int
+	// Start is the address of the first byte of formats without addresses.
+	Start uint32
+	// Fill is used for missing data in formats without addresses.
+	Fill byte
+}
+
+var formats []*Format
+
+// Register makes a format available by name and by file extension.
+func Register(f *Format) {
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats.
+func Formats() []*Format {
+	return formats
+}
+
+// FormatByName returns the format named name, or nil.
+func FormatByName(name string) *Format {
+	for _, f := range formats {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// FormatFor returns the format guessed from the file extension, or nil.
+func FormatFor(path string) *Format {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		for _, e := range f.Exts {
+			if e == ext {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Load reads the image file. The format is guessed from the extension if
+// format is empty.
+func Load(path, format string, base uint32) (*Image, error) {
+	var f *Format
+	if format != "" {
+		f = FormatByName(format)
+		if f == nil {
+			return nil, fmt.Errorf("unknown format: %s", format)
+		}
+	} else {
+		f = FormatFor(path)
+		if f == nil {
+			return nil, fmt.Errorf("unknown format of %s; please specify one", path)
+		}
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return f.Read(r, base)
+}
+
+// Save writes the image file. The format is guessed from the extension if
+// format is empty.
+func Save(path, format string, m *Image, opts *WriteOptions) error {
+	var f *Format
+	if format != "" {
+		f = FormatByName(format)
+		if f == nil {
+			return fmt.Errorf("unknown format: %s", format)
+		}
+	} else {
+		f = FormatFor(path)
+		if f == nil {
+			return fmt.Errorf("unknown format of %s; please specify one", path)
+		}
+	}
+	if f.Write == nil {
+		return fmt.Errorf("%s images can't be written", f.Name)
+	}
+
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = f.Write(w, m, opts)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,51 @@
+package firmware
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/marcinbor85/gohex"
+)
+
+// IntelHex is the Intel HEX format.
+var IntelHex = &Format{
+	Name:  "ihex",
+	Exts:  []string{".hex", ".ihex", ".ihx"},
+	Read:  readIntelHex,
+	Write: writeIntelHex,
+}
+
+func init() {
+	Register(IntelHex)
+}
+
+func readIntelHex(r io.Reader, _ uint32) (*Image, error) {
+	ihex := gohex.NewMemory()
+	err := ihex.ParseIntelHex(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := New()
+	for _, segment := range ihex.GetDataSegments() {
+		err := m.Add(segment.Address, segment.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func writeIntelHex(w io.Writer, m *Image, opts *WriteOptions) error {
+	if opts.RecordLen < 1 || opts.RecordLen > 255 {
+		return fmt.Errorf("ihex: invalid record length: %d", opts.RecordLen)
+	}
+	ihex := gohex.NewMemory()
+	for _, s := range m.Segments() {
+		err := ihex.AddBinary(s.Address, s.Data)
+		if err != nil {
+			return err
+		}
+	}
+	return ihex.DumpIntelHex(w, byte(opts.RecordLen))
+}
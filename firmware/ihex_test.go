@@ -0,0 +1,105 @@
+package firmware
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ihexLine formats an Intel HEX record with its checksum.
+func ihexLine(typ byte, addr uint16, data ...byte) string {
+	b := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}, data...)
+	sum := byte(0)
+	for _, v := range b {
+		sum += v
+	}
+	return fmt.Sprintf(":%X\n", append(b, -sum))
+}
+
+var ihexEOF = ihexLine(0x01, 0)
+
+func TestReadIntelHex(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []Segment
+		err   string
+	}{
+		{
+			name:  "data",
+			lines: []string{ihexLine(0x00, 0x0100, 1, 2, 3), ihexEOF},
+			want:  []Segment{{0x0100, []byte{1, 2, 3}}},
+		},
+		{
+			name:  "adjacent records",
+			lines: []string{ihexLine(0x00, 0x0000, 1, 2), ihexLine(0x00, 0x0002, 3), ihexEOF},
+			want:  []Segment{{0x0000, []byte{1, 2, 3}}},
+		},
+		{
+			name:  "extended segment address",
+			lines: []string{ihexLine(0x02, 0, 0x10, 0x00), ihexLine(0x00, 0x0004, 0xaa), ihexEOF},
+			want:  []Segment{{0x010004, []byte{0xaa}}},
+		},
+		{
+			name:  "extended linear address",
+			lines: []string{ihexLine(0x04, 0, 0x00, 0x30), ihexLine(0x00, 0x0000, 0x0f, 0xf0), ihexEOF},
+			want:  []Segment{{0x300000, []byte{0x0f, 0xf0}}},
+		},
+		{
+			name: "back to the first 64 KiB",
+			lines: []string{
+				ihexLine(0x04, 0, 0x00, 0x31), ihexLine(0x00, 0x0000, 1),
+				ihexLine(0x04, 0, 0x00, 0x00), ihexLine(0x00, 0x0000, 2),
+				ihexEOF,
+			},
+			want: []Segment{{0x000000, []byte{2}}, {0x310000, []byte{1}}},
+		},
+		{
+			name:  "start linear address",
+			lines: []string{ihexLine(0x00, 0x0000, 1), ihexLine(0x05, 0, 0x00, 0x00, 0x01, 0x00), ihexEOF},
+			want:  []Segment{{0x0000, []byte{1}}},
+		},
+		{
+			name:  "no data",
+			lines: []string{ihexEOF},
+		},
+		{
+			name:  "checksum",
+			lines: []string{":0300000001020305\n", ihexEOF},
+			err:   "checksum",
+		},
+		{
+			name:  "missing end of file",
+			lines: []string{ihexLine(0x00, 0x0000, 1)},
+			err:   "no end of file line",
+		},
+		{
+			name:  "overlapping records",
+			lines: []string{ihexLine(0x00, 0x0000, 1, 2), ihexLine(0x00, 0x0001, 2), ihexEOF},
+			err:   "overlap",
+		},
+		{
+			name:  "no colon",
+			lines: []string{"0100000001FE\n", ihexEOF},
+			err:   "colon",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := readIntelHex(strings.NewReader(strings.Join(tt.lines, "")), 0)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Segments(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package firmware reads and writes memory images of the target in various
+// file formats.
+package firmware
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Segment is a contiguous block of data.
+type Segment struct {
+	Address uint32
+	Data    []byte
+}
+
+// End returns the address just after the segment.
+func (s *Segment) End() uint32 {
+	return s.Address + uint32(len(s.Data))
+}
+
+// Symbol is a named address, as found in ELF files.
+type Symbol struct {
+	Name    string
+	Address uint32
+	Size    uint32
+}
+
+// Image is a sparse memory image: sorted, non-overlapping segments.
+type Image struct {
+	segments []Segment
+
+	// Symbols is empty for formats without symbols.
+	Symbols []Symbol
+}
+
+// New returns an empty image.
+func New() *Image {
+	return &Image{}
+}
+
+// Segments returns the segments sorted by address. Adjacent data is merged.
+func (m *Image) Segments() []Segment {
+	return m.segments
+}
+
+// Len returns the number of bytes of data.
+func (m *Image) Len() int {
+	n := 0
+	for _, s := range m.segments {
+		n += len(s.Data)
+	}
+	return n
+}
+
+// Add adds data at addr. Overlapping data must be identical.
+func (m *Image) Add(addr uint32, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	end := addr + uint32(len(data))
+	if end < addr {
+		return fmt.Errorf("data at %06x wraps around", addr)
+	}
+
+	// segments overlapping or adjacent to the new data
+	first := sort.Search(len(m.segments), func(i int) bool { return m.segments[i].End() >= addr })
+	last := first
+	for last < len(m.segments) && m.segments[last].Address <= end {
+		last++
+	}
+
+	start := addr
+	stop := end
+	for _, s := range m.segments[first:last] {
+		for a := max(s.Address, addr); a < min(s.End(), end); a++ {
+			if s.Data[a-s.Address] != data[a-addr] {
+				return fmt.Errorf("conflicting data at %06x: %02x and %02x", a, s.Data[a-s.Address], data[a-addr])
+			}
+		}
+		start = min(start, s.Address)
+		stop = max(stop, s.End())
+	}
+
+	merged := make([]byte, stop-start)
+	for _, s := range m.segments[first:last] {
+		copy(merged[s.Address-start:], s.Data)
+	}
+	copy(merged[addr-start:], data)
+
+	segments := append([]Segment{}, m.segments[:first]...)
+	segments = append(segments, Segment{Address: start, Data: merged})
+	m.segments = append(segments, m.segments[last:]...)
+	return nil
+}
+
+// Set writes data at addr, overwriting any existing data.
+func (m *Image) Set(addr uint32, data []byte) {
+	end := addr + uint32(len(data))
+	for _, s := range m.segments {
+		if s.Address < end && addr < s.End() {
+			lo := max(s.Address, addr)
+			hi := min(s.End(), end)
+			copy(s.Data[lo-s.Address:hi-s.Address], data[lo-addr:hi-addr])
+		}
+	}
+	// now identical where overlapping
+	_ = m.Add(addr, data)
+}
+
+// Overlaps reports whether the image has data in [start, end).
+func (m *Image) Overlaps(start, end uint32) bool {
+	for _, s := range m.segments {
+		if s.Address < end && start < s.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract returns the part of the image in [start, end).
+func (m *Image) Extract(start, end uint32) *Image {
+	sub := &Image{Symbols: m.Symbols}
+	for _, s := range m.segments {
+		if s.Address < end && start < s.End() {
+			lo := max(s.Address, start)
+			hi := min(s.End(), end)
+			data := append([]byte{}, s.Data[lo-s.Address:hi-s.Address]...)
+			sub.segments = append(sub.segments, Segment{Address: lo, Data: data})
+		}
+	}
+	return sub
+}
+
+// Slice returns the data in [start, end), using fill for missing data.
+func (m *Image) Slice(start, end uint32, fill byte) []byte {
+	b := make([]byte, end-start)
+	for i := range b {
+		b[i] = fill
+	}
+	for _, s := range m.segments {
+		if s.Address < end && start < s.End() {
+			lo := max(s.Address, start)
+			hi := min(s.End(), end)
+			copy(b[lo-start:hi-start], s.Data[lo-s.Address:hi-s.Address])
+		}
+	}
+	return b
+}
+
+// SymbolAt describes addr as "symbol+offset" using the symbol containing it,
+// or else the closest symbol before it. It returns "" if there is none.
+func (m *Image) SymbolAt(addr uint32) string {
+	var best *Symbol
+	for i := range m.Symbols {
+		s := &m.Symbols[i]
+		if s.Address > addr {
+			continue
+		}
+		if s.Size != 0 && addr < s.Address+s.Size {
+			best = s
+			break
+		}
+		if best == nil || s.Address > best.Address {
+			best = s
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	if addr == best.Address {
+		return best.Name
+	}
+	return fmt.Sprintf("%s+0x%x", best.Name, addr-best.Address)
+}
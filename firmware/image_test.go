@@ -0,0 +1,105 @@
+package firmware
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImageAdd(t *testing.T) {
+	type add struct {
+		addr uint32
+		data []byte
+	}
+	tests := []struct {
+		name string
+		adds []add
+		want []Segment
+		err  string
+	}{
+		{
+			name: "disjoint",
+			adds: []add{{0x10, []byte{1}}, {0x00, []byte{2}}},
+			want: []Segment{{0x00, []byte{2}}, {0x10, []byte{1}}},
+		},
+		{
+			name: "adjacent",
+			adds: []add{{0x00, []byte{1, 2}}, {0x02, []byte{3}}},
+			want: []Segment{{0x00, []byte{1, 2, 3}}},
+		},
+		{
+			name: "identical overlap",
+			adds: []add{{0x00, []byte{1, 2, 3}}, {0x01, []byte{2, 3, 4}}},
+			want: []Segment{{0x00, []byte{1, 2, 3, 4}}},
+		},
+		{
+			name: "bridging",
+			adds: []add{{0x00, []byte{1}}, {0x03, []byte{4}}, {0x01, []byte{2, 3}}},
+			want: []Segment{{0x00, []byte{1, 2, 3, 4}}},
+		},
+		{
+			name: "empty",
+			adds: []add{{0x00, nil}},
+		},
+		{
+			name: "conflicting overlap",
+			adds: []add{{0x00, []byte{1, 2, 3}}, {0x02, []byte{4}}},
+			err:  "conflicting data at 000002: 03 and 04",
+		},
+		{
+			name: "wraparound",
+			adds: []add{{0xffff_ffff, []byte{1, 2}}},
+			err:  "wraps around",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			var err error
+			for _, a := range tt.adds {
+				if err = m.Add(a.addr, a.data); err != nil {
+					break
+				}
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Segments(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageOverlapsAndSlice(t *testing.T) {
+	m := New()
+	m.Add(0x10, []byte{1, 2})
+	m.Add(0x20, []byte{3})
+
+	tests := []struct {
+		start, end uint32
+		overlaps   bool
+		slice      []byte
+	}{
+		{0x00, 0x10, false, bytes.Repeat([]byte{0xff}, 16)},
+		{0x0f, 0x11, true, []byte{0xff, 1}},
+		{0x11, 0x21, true, append(append([]byte{2}, bytes.Repeat([]byte{0xff}, 14)...), 3)},
+		{0x12, 0x20, false, bytes.Repeat([]byte{0xff}, 14)},
+		{0x21, 0x22, false, []byte{0xff}},
+	}
+	for _, tt := range tests {
+		if got := m.Overlaps(tt.start, tt.end); got != tt.overlaps {
+			t.Errorf("Overlaps(%#x, %#x) = %t, want %t", tt.start, tt.end, got, tt.overlaps)
+		}
+		if got := m.Slice(tt.start, tt.end, 0xff); !bytes.Equal(got, tt.slice) {
+			t.Errorf("Slice(%#x, %#x) = %x, want %x", tt.start, tt.end, got, tt.slice)
+		}
+	}
+}
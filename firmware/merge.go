@@ -0,0 +1,81 @@
+package firmware
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict is an address range where two merged images have different data.
+type Conflict struct {
+	Start uint32
+	End   uint32
+	A     string
+	B     string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s and %s differ at %06x-%06x (%d bytes)", c.A, c.B, c.Start, c.End-1, c.End-c.Start)
+}
+
+// MergeError is returned when merged images overlap with different data.
+type MergeError struct {
+	Conflicts []Conflict
+}
+
+func (e *MergeError) Error() string {
+	s := make([]string, 0, len(e.Conflicts)+1)
+	s = append(s, "images overlap with different data:")
+	for _, c := range e.Conflicts {
+		s = append(s, "  "+c.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+// Merge merges the images into one. Overlapping data must be identical,
+// otherwise a *MergeError lists every conflicting range. names identify the
+// images in the report.
+func Merge(names []string, images []*Image) (*Image, error) {
+	var conflicts []Conflict
+	for i := range images {
+		for j := 0; j < i; j++ {
+			conflicts = append(conflicts, compare(names[j], images[j], names[i], images[i])...)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, &MergeError{Conflicts: conflicts}
+	}
+
+	m := New()
+	for _, img := range images {
+		for _, s := range img.Segments() {
+			err := m.Add(s.Address, s.Data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		m.Symbols = append(m.Symbols, img.Symbols...)
+	}
+	return m, nil
+}
+
+// compare returns the ranges where a and b both have data which differ.
+func compare(nameA string, a *Image, nameB string, b *Image) []Conflict {
+	var conflicts []Conflict
+	for _, sa := range a.Segments() {
+		for _, sb := range b.Segments() {
+			lo := max(sa.Address, sb.Address)
+			hi := min(sa.End(), sb.End())
+			for addr := lo; addr < hi; addr++ {
+				if sa.Data[addr-sa.Address] == sb.Data[addr-sb.Address] {
+					continue
+				}
+				if n := len(conflicts); n > 0 && conflicts[n-1].End == addr {
+					conflicts[n-1].End++
+					continue
+				}
+				conflicts = append(conflicts, Conflict{Start: addr, End: addr + 1, A: nameA, B: nameB})
+			}
+		}
+	}
+	return conflicts
+}
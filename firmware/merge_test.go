@@ -0,0 +1,106 @@
+package firmware
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// image builds an image from address and data pairs.
+func image(t *testing.T, segments ...Segment) *Image {
+	t.Helper()
+	m := New()
+	for _, s := range segments {
+		if err := m.Add(s.Address, s.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		images    [][]Segment
+		want      []Segment
+		conflicts []Conflict
+	}{
+		{
+			name:   "disjoint",
+			images: [][]Segment{{{0x00, []byte{1}}}, {{0x10, []byte{2}}}},
+			want:   []Segment{{0x00, []byte{1}}, {0x10, []byte{2}}},
+		},
+		{
+			name:   "adjacent",
+			images: [][]Segment{{{0x00, []byte{1}}}, {{0x01, []byte{2}}}},
+			want:   []Segment{{0x00, []byte{1, 2}}},
+		},
+		{
+			name:   "identical overlap",
+			images: [][]Segment{{{0x00, []byte{1, 2, 3}}}, {{0x02, []byte{3, 4}}}},
+			want:   []Segment{{0x00, []byte{1, 2, 3, 4}}},
+		},
+		{
+			name:   "one range",
+			images: [][]Segment{{{0x00, []byte{1, 2, 3, 4}}}, {{0x01, []byte{9, 9, 4}}}},
+			conflicts: []Conflict{
+				{Start: 0x01, End: 0x03, A: "a", B: "b"},
+			},
+		},
+		{
+			name:   "ranges split by identical data",
+			images: [][]Segment{{{0x00, []byte{1, 2, 3, 4}}}, {{0x00, []byte{9, 2, 9, 9}}}},
+			conflicts: []Conflict{
+				{Start: 0x00, End: 0x01, A: "a", B: "b"},
+				{Start: 0x02, End: 0x04, A: "a", B: "b"},
+			},
+		},
+		{
+			name: "every pair",
+			images: [][]Segment{
+				{{0x00, []byte{1}}},
+				{{0x00, []byte{2}}},
+				{{0x00, []byte{3}}},
+			},
+			conflicts: []Conflict{
+				{Start: 0x00, End: 0x01, A: "a", B: "b"},
+				{Start: 0x00, End: 0x01, A: "a", B: "c"},
+				{Start: 0x00, End: 0x01, A: "b", B: "c"},
+			},
+		},
+	}
+	names := []string{"a", "b", "c"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var images []*Image
+			for _, segments := range tt.images {
+				images = append(images, image(t, segments...))
+			}
+			m, err := Merge(names[:len(images)], images)
+			if tt.conflicts != nil {
+				var merr *MergeError
+				if !errors.As(err, &merr) {
+					t.Fatalf("error = %v, want a *MergeError", err)
+				}
+				if !reflect.DeepEqual(merr.Conflicts, tt.conflicts) {
+					t.Errorf("conflicts = %v, want %v", merr.Conflicts, tt.conflicts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Segments(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictString(t *testing.T) {
+	c := Conflict{Start: 0x1000, End: 0x1004, A: "boot.hex", B: "app.hex"}
+	want := "boot.hex and app.hex differ at 001000-001003 (4 bytes)"
+	if got := c.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
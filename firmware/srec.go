@@ -0,0 +1,131 @@
+package firmware
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SRecord is the Motorola S-record format.
+var SRecord = &Format{
+	Name:  "srec",
+	Exts:  []string{".srec", ".s19", ".s28", ".s37", ".mot"},
+	Read:  readSRecord,
+	Write: writeSRecord,
+}
+
+func init() {
+	Register(SRecord)
+}
+
+func readSRecord(r io.Reader, _ uint32) (*Image, error) {
+	m := New()
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		err := m.parseSRecord(text)
+		if err != nil {
+			return nil, fmt.Errorf("srec: line %d: %w", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Image) parseSRecord(text string) error {
+	if len(text) < 4 || text[0] != 'S' {
+		return fmt.Errorf("invalid record: %q", text)
+	}
+	b, err := hex.DecodeString(text[2:])
+	if err != nil {
+		return err
+	}
+	if len(b) < 1 || int(b[0]) != len(b)-1 {
+		return fmt.Errorf("invalid byte count")
+	}
+	sum := byte(0)
+	for _, v := range b[:len(b)-1] {
+		sum += v
+	}
+	if ^sum != b[len(b)-1] {
+		return fmt.Errorf("invalid checksum")
+	}
+	b = b[1 : len(b)-1]
+
+	var addrLen int
+	switch text[1] {
+	case '1':
+		addrLen = 2
+	case '2':
+		addrLen = 3
+	case '3':
+		addrLen = 4
+	case '0', '5', '6', '7', '8', '9':
+		// header, record count, start address
+		return nil
+	default:
+		return fmt.Errorf("unknown record type: S%c", text[1])
+	}
+	if len(b) < addrLen {
+		return fmt.Errorf("invalid address")
+	}
+	addr := uint32(0)
+	for _, v := range b[:addrLen] {
+		addr = addr<<8 | uint32(v)
+	}
+	return m.Add(addr, b[addrLen:])
+}
+
+func writeSRecord(w io.Writer, m *Image, opts *WriteOptions) error {
+	if opts.RecordLen < 1 || opts.RecordLen > 250 {
+		return fmt.Errorf("srec: invalid record length: %d", opts.RecordLen)
+	}
+
+	// the smallest address size for all the data
+	data, term, addrLen := byte('1'), byte('9'), 2
+	if segments := m.Segments(); len(segments) > 0 {
+		switch end := segments[len(segments)-1].End() - 1; {
+		case end > 0xff_ffff:
+			data, term, addrLen = '3', '7', 4
+		case end > 0xffff:
+			data, term, addrLen = '2', '8', 3
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	writeSRecordLine(bw, '0', 0, 2, nil)
+	count := 0
+	for _, s := range m.Segments() {
+		for i := 0; i < len(s.Data); i += opts.RecordLen {
+			chunk := s.Data[i:min(i+opts.RecordLen, len(s.Data))]
+			writeSRecordLine(bw, data, s.Address+uint32(i), addrLen, chunk)
+			count++
+		}
+	}
+	if count <= 0xffff {
+		writeSRecordLine(bw, '5', uint32(count), 2, nil)
+	}
+	writeSRecordLine(bw, term, 0, addrLen, nil)
+	return bw.Flush()
+}
+
+func writeSRecordLine(w *bufio.Writer, typ byte, addr uint32, addrLen int, data []byte) {
+	b := []byte{byte(addrLen + len(data) + 1)}
+	for i := addrLen - 1; i >= 0; i-- {
+		b = append(b, byte(addr>>(8*i)))
+	}
+	b = append(b, data...)
+	sum := byte(0)
+	for _, v := range b {
+		sum += v
+	}
+	b = append(b, ^sum)
+	fmt.Fprintf(w, "S%c%s\n", typ, strings.ToUpper(hex.EncodeToString(b)))
+}
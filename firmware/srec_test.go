@@ -0,0 +1,102 @@
+package firmware
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// srecLine formats an S-record with its byte count and checksum.
+func srecLine(typ byte, addr []byte, data ...byte) string {
+	b := append([]byte{byte(len(addr) + len(data) + 1)}, addr...)
+	b = append(b, data...)
+	sum := byte(0)
+	for _, v := range b {
+		sum += v
+	}
+	return fmt.Sprintf("S%c%X\n", typ, append(b, ^sum))
+}
+
+func TestReadSRecord(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []Segment
+		err   string
+	}{
+		{
+			name:  "S1",
+			lines: []string{srecLine('1', []byte{0x01, 0x00}, 1, 2, 3), srecLine('9', []byte{0, 0})},
+			want:  []Segment{{0x0100, []byte{1, 2, 3}}},
+		},
+		{
+			name:  "S2",
+			lines: []string{srecLine('2', []byte{0x30, 0x00, 0x00}, 0x0f, 0xf0), srecLine('8', []byte{0, 0, 0})},
+			want:  []Segment{{0x300000, []byte{0x0f, 0xf0}}},
+		},
+		{
+			name:  "S3",
+			lines: []string{srecLine('3', []byte{0x00, 0x31, 0x00, 0x00}, 0xaa), srecLine('7', []byte{0, 0, 0, 0})},
+			want:  []Segment{{0x310000, []byte{0xaa}}},
+		},
+		{
+			name: "header and count ignored",
+			lines: []string{
+				srecLine('0', []byte{0, 0}, 'h', 'i'),
+				srecLine('1', []byte{0x00, 0x00}, 1),
+				srecLine('1', []byte{0x00, 0x01}, 2),
+				srecLine('5', []byte{0x00, 0x02}),
+				"\n",
+			},
+			want: []Segment{{0x0000, []byte{1, 2}}},
+		},
+		{
+			name:  "checksum",
+			lines: []string{"S1060000010203F0\n"},
+			err:   "line 1: invalid checksum",
+		},
+		{
+			name:  "byte count",
+			lines: []string{srecLine('1', []byte{0, 0}, 1), "S1070000010203F2\n"},
+			err:   "line 2: invalid byte count",
+		},
+		{
+			name:  "unknown type",
+			lines: []string{srecLine('4', []byte{0, 0}, 1)},
+			err:   "unknown record type: S4",
+		},
+		{
+			name:  "short address",
+			lines: []string{srecLine('3', []byte{0, 0})},
+			err:   "invalid address",
+		},
+		{
+			name:  "not a record",
+			lines: []string{":0100000001FE\n"},
+			err:   "invalid record",
+		},
+		{
+			name:  "conflicting records",
+			lines: []string{srecLine('1', []byte{0, 0}, 1, 2), srecLine('1', []byte{0, 1}, 3)},
+			err:   "line 2: conflicting data at 000001: 02 and 03",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := readSRecord(strings.NewReader(strings.Join(tt.lines, "")), 0)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Segments(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
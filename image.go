@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/ftPIC/d2xx"
+	"github.com/ysh86/ftPIC/firmware"
+)
+
+// loadImage loads and merges the image files.
+func loadImage(files []string, opts *options) (*firmware.Image, error) {
+	images := make([]*firmware.Image, len(files))
+	for i, file := range files {
+		img, err := firmware.Load(file, opts.format, uint32(opts.base))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 1 {
+			fmt.Fprintf(stdout, "%s:\n", file)
+		}
+		printSegments(img)
+		images[i] = img
+	}
+	if len(files) == 1 {
+		return images[0], nil
+	}
+
+	img, err := firmware.Merge(files, images)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(stdout, "merged:")
+	printSegments(img)
+	return img, nil
+}
+
+func printSegments(img *firmware.Image) {
+	for _, s := range img.Segments() {
+		b := s.Address
+		e := s.End()
+		fmt.Fprintf(stdout, "segment: %06x-%06x: %7d [bytes]\n", b, e, e-b)
+	}
+}
+
+// checkImage fails if the image has data outside of the device memory.
+func checkImage(img *firmware.Image, dev *d2xx.Device) error {
+	regions := dev.Regions()
+	for _, s := range img.Segments() {
+		for addr := s.Address; addr < s.End(); {
+			next := addr
+			for _, mr := range regions {
+				if mr.Start <= addr && addr < mr.End {
+					next = min(mr.End, s.End())
+					break
+				}
+			}
+			if next == addr {
+				return fmt.Errorf("data at %06x is outside of %s memory", addr, dev.Name)
+			}
+			addr = next
+		}
+	}
+	return nil
+}
+
+// checkConfig refuses the configuration of the image if it may lock out this
+// programmer, unless forced.
+func checkConfig(dev *d2xx.Device, img *firmware.Image, force bool) error {
+	mr, ok := dev.Region(d2xx.REGION_CONFIGURATION)
+	if !ok || force || !img.Overlaps(mr.Start, mr.End) {
+		return nil
+	}
+	if hazards := dev.CheckConfig(img.Slice(mr.Start, mr.End, 0xff)); len(hazards) > 0 {
+		return fmt.Errorf("%s: %w", mr.Name, &d2xx.DangerousConfigError{Hazards: hazards})
+	}
+	return nil
+}
+
+// writeImage programs each region having data in the image. A dangerous
+// configuration is refused before anything is erased.
+func writeImage(flash *d2xx.Flash, img *firmware.Image, opts *options) error {
+	if err := checkConfig(flash.Device, img, opts.force); err != nil {
+		return err
+	}
+
+	for _, mr := range flash.Device.Regions() {
+		if !img.Overlaps(mr.Start, mr.End) {
+			continue
+		}
+		data := img.Slice(mr.Start, mr.End, 0xff)
+
+		var err error
+		switch mr.Region {
+		case d2xx.REGION_FLASH:
+			err = writeFlash(flash, data, opts.protect)
+		case d2xx.REGION_DATA_EEPROM:
+			err = flash.WriteEEPROM(data)
+		case d2xx.REGION_USER_ID:
+			err = flash.WriteUserIDs(data)
+		case d2xx.REGION_CONFIGURATION:
+			err = flash.WriteConfig(data, opts.force)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", mr.Name, err)
+		}
+	}
+	return nil
+}
+
+func writeFlash(flash *d2xx.Flash, data []byte, protect []d2xx.AddressRange) error {
+	if len(protect) > 0 {
+		return flash.WritePFMProtected(data, protect)
+	}
+
+	err := flash.BulkErase(d2xx.REGION_FLASH)
+	if err != nil {
+		return err
+	}
+	_, err = flash.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return flash.WritePFM(data)
+}
+
+// verifyImage reads back each region having data in the image.
+func verifyImage(flash *d2xx.Flash, img *firmware.Image, opts *options) error {
+	for _, mr := range flash.Device.Regions() {
+		if !img.Overlaps(mr.Start, mr.End) {
+			continue
+		}
+		data := img.Slice(mr.Start, mr.End, 0xff)
+		err := flash.Verify(mr.Region, data, opts.protect)
+		var verr *d2xx.VerifyError
+		if errors.As(err, &verr) {
+			if sym := img.SymbolAt(verr.Address); sym != "" {
+				return fmt.Errorf("%s: %w (%s)", mr.Name, err, sym)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", mr.Name, err)
+		}
+	}
+	return nil
+}
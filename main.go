@@ -1,115 +1,304 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/ysh86/ftPIC/d2xx"
-
-	"github.com/marcinbor85/gohex"
+	"github.com/ysh86/ftPIC/firmware"
 )
 
+// options are the command line flags of the default command.
+type options struct {
+	outFile     string
+	inFiles     filesFlag
+	ihexFile    string
+	verifyFiles filesFlag
+	format      string
+	base        uint64
+	protect     rangesFlag
+	force       bool
+	checksum    bool
+	jsonOut     bool
+	auditFile   string
+	flash       flashFlags
+
+	// serialization
+	serialState  string
+	serialStart  uint64
+	serialFormat string
+	serialAddr   uint64
+	sqtpFile     string
+}
+
 func main() {
 	// args
-	var (
-		outFile  string
-		inFile   string
-		ihexFile string
-	)
-	flag.StringVar(&outFile, "r", "", "read whole internal flash")
-	flag.StringVar(&inFile, "w", "", "an ihex file to write")
-	flag.StringVar(&ihexFile, "i", "", "dump ihex to raw bin")
+	var opts options
+	flag.StringVar(&opts.outFile, "r", "", "read whole internal flash")
+	flag.Var(&opts.inFiles, "w", "image file(s) to merge and write (repeatable)")
+	flag.StringVar(&opts.ihexFile, "i", "", "dump an image file to raw bin")
+	flag.Var(&opts.verifyFiles, "v", "image file(s) to merge and verify the target against (repeatable)")
+	flag.StringVar(&opts.format, "f", "", "image file format: ihex, srec, bin or elf (default: guessed from the extension)")
+	flag.Uint64Var(&opts.base, "base", 0, "load address of raw binary images")
+	flag.Var(&opts.protect, "p", "protected flash range(s) kept while writing, e.g. 0x0000-0x1fff (repeatable)")
+	flag.BoolVar(&opts.force, "force", false, "allow configuration values which may lock out this programmer")
+	flag.BoolVar(&opts.checksum, "checksum", false, "read back the whole target and print its checksums, as -v and a run without -w, -r or -v also do")
+	flag.StringVar(&opts.serialState, "serial-state", "", "serialize each device; the JSON-lines file records the serials used")
+	flag.Uint64Var(&opts.serialStart, "serial-start", 1, "first serial number when the state file is empty")
+	flag.StringVar(&opts.serialFormat, "serial-format", "%08d", "format of the serial number written as text")
+	flag.Uint64Var(&opts.serialAddr, "serial-addr", 0x20_0000, "address of the serial number, in the user IDs or the EEPROM")
+	flag.StringVar(&opts.sqtpFile, "sqtp", "", "take the serials from an SQTP file instead of -serial-start/-serial-format")
+	flag.BoolVar(&opts.jsonOut, "json", false, "print a single JSON document instead of text")
+	opts.flash.register(flag.CommandLine)
+	flag.StringVar(&opts.auditFile, "audit", "", "append a JSON-lines record of each erase, write and verify to the file")
 	flag.Parse()
 	if len(flag.Args()) > 0 {
-		flag.Usage()
-		return
+		switch flag.Arg(0) {
+		case "config":
+			runConfig(flag.Args()[1:])
+		case "convert":
+			runConvert(flag.Args()[1:])
+		case "checksum":
+			runChecksum(flag.Args()[1:])
+		case "bench":
+			runBench(flag.Args()[1:])
+		case "replay":
+			runReplay(flag.Args()[1:])
+		case "vcd":
+			runVCD(flag.Args()[1:])
+		case "adapter":
+			runAdapter(flag.Args()[1:])
+		default:
+			flag.Usage()
+			exitStatus = exitUsage
+		}
+		os.Exit(exitStatus)
 	}
 
+	if opts.jsonOut {
+		stdout = io.Discard
+	}
+	rep := newReport()
+	run(rep, &opts)
+	if opts.jsonOut {
+		if err := rep.writeJSON(os.Stdout); err != nil {
+			fail("json", err)
+		}
+	}
+	os.Exit(exitStatus)
+}
+
+func run(rep *report, opts *options) {
 	// load
 	var err error
-	var data []byte
-	if ihexFile != "" {
-		inFile = ihexFile
+	var img *firmware.Image
+	inFiles := opts.inFiles
+	if opts.ihexFile != "" {
+		inFiles = filesFlag{opts.ihexFile}
 	}
-	if inFile != "" {
-		fmt.Println("Load info:")
-		data, err = loadHex(inFile)
+	loadFiles := inFiles
+	if len(loadFiles) == 0 {
+		loadFiles = opts.verifyFiles
+	} else if len(opts.verifyFiles) > 0 && !slices.Equal(opts.verifyFiles, inFiles) {
+		rep.fail("verify", errors.New("-v must be the same files as -w"))
+		return
+	}
+	if len(loadFiles) > 0 {
+		fmt.Fprintln(stdout, "Load info:")
+		img, err = loadImage(loadFiles, opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "loadHex: %s\n", err)
+			rep.fail("load", err)
 			return
 		}
-		fmt.Println()
+		fmt.Fprintln(stdout)
+
+		rep.Image = &imageInfo{Files: loadFiles}
+		for _, s := range img.Segments() {
+			u := d2xx.AddressRange{Start: s.Address, End: s.End()}
+			rep.Image.Segments = append(rep.Image.Segments, u.String())
+			for _, p := range opts.protect {
+				if u.Overlaps(p) {
+					rep.fail("load", fmt.Errorf("segment %s overlaps protected range %s", u, p))
+					return
+				}
+			}
+		}
 	}
 
 	// load only
-	if ihexFile != "" {
+	if opts.ihexFile != "" {
 		//Mandelbrot()
-		binFile := ihexFile + ".bin"
+		binFile := opts.ihexFile + ".bin"
+		data := []byte{}
+		if segments := img.Segments(); len(segments) > 0 {
+			data = img.Slice(0, segments[len(segments)-1].End(), 0xff)
+		}
 		err := os.WriteFile(binFile, data, 0666)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "load: %s\n", err)
+			rep.fail("load", err)
 		}
 		return
 	}
 
-	flash, err := d2xx.OpenFlash()
+	flash, err := opts.flash.open()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "d2xx: %s\n", err)
+		rep.fail("d2xx", err)
 		return
 	}
-	defer flash.Close()
+	defer opts.flash.close(flash)
+	if opts.auditFile != "" {
+		audit, err := openAuditLog(opts.auditFile)
+		if err != nil {
+			rep.fail("audit", err)
+			return
+		}
+		defer audit.Close()
+		flash.SetAuditLog(audit)
+	}
 
 	// ft (writer)
-	verMajor, verMinor, verPatch := d2xx.Version()
+	rep.setWriter(flash)
 	devType, venID, devID := flash.WriterInfo()
-	fmt.Println("Writer info:")
-	fmt.Printf("d2xx library version: %d.%d.%d\n", verMajor, verMinor, verPatch)
-	fmt.Printf("DevType: %v(%d), vendor ID: 0x%04x, device ID: 0x%04x\n", devType, devType, venID, devID)
-	fmt.Println()
+	fmt.Fprintln(stdout, "Writer info:")
+	fmt.Fprintf(stdout, "d2xx library version: %s\n", rep.Library)
+	fmt.Fprintf(stdout, "DevType: %v(%d), vendor ID: 0x%04x, device ID: 0x%04x, serial: %s\n", devType, devType, venID, devID, flash.WriterSerial())
+	fmt.Fprintf(stdout, "ICSP clock: %d Hz\n", flash.ClockHz())
+	fmt.Fprintf(stdout, "USB: %s\n", flash.USB())
+	if rec := flash.AdapterRecord(); rec != nil {
+		fmt.Fprintf(stdout, "adapter: %s\n", rec)
+	}
+	fmt.Fprintln(stdout)
 
 	// target
-	fmt.Println("Target info:")
-	fmt.Printf("device: %04X, revision: %04X (%s%d)\n",
+	rep.setTarget(flash)
+	fmt.Fprintln(stdout, "Target info:")
+	fmt.Fprintf(stdout, "device: %04X (%s), revision: %04X (%s%d)\n",
 		flash.DeviceID,
+		flash.Device.Name,
 		flash.RevisionID,
 		flash.RevisionMajor,
 		flash.RevisionMinor,
 	)
-	fmt.Printf("User IDs (32 Words)\n")
+	fmt.Fprintf(stdout, "unique ID: %s\n", flash.DIA.UniqueID())
+	fmt.Fprintf(stdout, "timing: %s\n", flash.Timing())
+	for _, w := range rep.Target.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	fmt.Fprintf(stdout, "User IDs (32 Words)\n")
 	for i := 0; i < 32; i += 8 {
 		for ii := 0; ii < 8; ii++ {
 			value16 := flash.UserIDs[i+ii]
-			fmt.Printf(" %02x %02x", value16[0], value16[1])
+			fmt.Fprintf(stdout, " %02x %02x", value16[0], value16[1])
 		}
-		fmt.Println()
+		fmt.Fprintln(stdout)
 	}
-	fmt.Printf("Configuration Bytes (10 Bytes)\n")
-	for i := 0; i < 10; i++ {
-		fmt.Printf(" %02x", flash.Configuration[i])
+	printConfig(flash.Device, flash.Configuration[:])
+	fmt.Fprintln(stdout)
+
+	var ser *serializer
+	var serial *serialAssignment
+	if img != nil {
+		err := checkImage(img, flash.Device)
+		if err != nil {
+			rep.fail("load", err)
+			return
+		}
+		if opts.serialState != "" {
+			if len(inFiles) == 0 {
+				rep.fail("serial", errors.New("serialization requires -w"))
+				return
+			}
+			ser, err = newSerializer(opts)
+			if err != nil {
+				rep.fail("serial", err)
+				return
+			}
+			serial, err = ser.assign(img, flash.DIA.UniqueID())
+			if err != nil {
+				rep.fail("serial", err)
+				return
+			}
+			defer func() {
+				// releases the claim, unless the serial was reserved
+				// before writing
+				written := false
+				for _, o := range rep.Operations {
+					written = written || (o.Op == "write" && o.Result == "ok")
+				}
+				if err := ser.record(serial, flash.DIA.UniqueID(), written, rep.Error); err != nil {
+					rep.fail("serial", err)
+				}
+			}()
+			if err := checkImage(img, flash.Device); err != nil {
+				rep.fail("serial", err)
+				return
+			}
+			rep.Serial = serial
+			fmt.Fprintf(stdout, "serial: %s at %06x (#%d)\n", serial.Serial, serial.Address, serial.Index)
+		}
+		rep.Checksums["image"] = imageChecksums(flash.Device, img)
+		printChecksums("image", rep.Checksums["image"])
+		fmt.Fprintln(stdout)
 	}
-	fmt.Println()
-	fmt.Println()
 
 	// dump
-	if outFile != "" {
-		n, err := dumpFlash(flash, outFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "dump: %s\n", err)
-		} else {
-			fmt.Printf("dump: %d [bytes]\n", n)
+	if opts.outFile != "" {
+		o := rep.begin("read", opts.outFile)
+		n, err := dumpFlash(flash, opts.outFile)
+		rep.end(o, n, err)
+		if err == nil {
+			fmt.Fprintf(stdout, "dump: %d [bytes]\n", n)
 		}
 	}
 
-	// write ihex
-	if inFile != "" {
-		err := writeFlash(flash, data)
+	// write
+	if len(inFiles) > 0 {
+		if ser != nil {
+			// a refused configuration must not consume the serial
+			if err := checkConfig(flash.Device, img, opts.force); err != nil {
+				rep.fail("write", err)
+				return
+			}
+			err := ser.reserve(serial, flash.DIA.UniqueID())
+			if err != nil {
+				rep.fail("serial", err)
+				return
+			}
+		}
+		o := rep.begin("write", inFiles.String())
+		err := writeImage(flash, img, opts)
+		rep.end(o, int64(img.Len()), err)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "write: %s\n", err)
-		} else {
-			fmt.Println("write: done")
+			return
+		}
+		fmt.Fprintln(stdout, "write: done")
+	}
+
+	// verify
+	if len(opts.verifyFiles) > 0 {
+		o := rep.begin("verify", opts.verifyFiles.String())
+		err := verifyImage(flash, img, opts)
+		rep.end(o, int64(img.Len()), err)
+		if err == nil {
+			fmt.Fprintln(stdout, "verify: done")
+		}
+	}
+
+	// checksum: what verify and info are cross-checked with
+	info := len(inFiles) == 0 && len(opts.verifyFiles) == 0 && opts.outFile == ""
+	if opts.checksum || len(opts.verifyFiles) > 0 || info {
+		o := rep.begin("checksum", "")
+		c, err := deviceChecksums(flash)
+		rep.end(o, 0, err)
+		if err == nil {
+			rep.Checksums["device"] = c
+			printChecksums("device", c)
 		}
 	}
 }
@@ -134,48 +323,47 @@ func dumpFlash(flash *d2xx.Flash, outFile string) (n int64, err error) {
 	return n, err
 }
 
-func writeFlash(flash *d2xx.Flash, data []byte) error {
-	err := flash.BulkErase(d2xx.REGION_FLASH)
-	if err != nil {
-		return err
-	}
-	_, err = flash.Seek(0, io.SeekStart)
-	if err != nil {
-		return err
-	}
-	return flash.WritePFM(data)
-}
+// filesFlag collects file names given either comma separated or repeatedly.
+type filesFlag []string
 
-func loadHex(ihexFile string) ([]byte, error) {
-	r, err := os.Open(ihexFile)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Close()
+func (f *filesFlag) String() string {
+	return strings.Join(*f, ",")
+}
 
-	ihex := gohex.NewMemory()
-	err = ihex.ParseIntelHex(r)
-	if err != nil {
-		return nil, err
-	}
+func (f *filesFlag) Set(value string) error {
+	*f = append(*f, strings.Split(value, ",")...)
+	return nil
+}
 
-	var w bytes.Buffer
-	i := 0
-	for _, segment := range ihex.GetDataSegments() {
-		b := int(segment.Address)
-		e := b + len(segment.Data)
-		data := segment.Data[0:]
+// rangesFlag collects inclusive address ranges like "0x0000-0x1fff".
+type rangesFlag []d2xx.AddressRange
 
-		fmt.Printf("segment: %06x-%06x: %7d [bytes]\n", b, e, e-b)
+func (r *rangesFlag) String() string {
+	var s []string
+	for _, v := range *r {
+		s = append(s, v.String())
+	}
+	return strings.Join(s, ",")
+}
 
-		for i < b {
-			w.WriteByte(0xff)
-			i++
+func (r *rangesFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		first, last, ok := strings.Cut(v, "-")
+		if !ok {
+			return fmt.Errorf("invalid range: %q", v)
 		}
-
-		w.Write(data)
-		i += len(data)
+		start, err := strconv.ParseUint(strings.TrimSpace(first), 0, 32)
+		if err != nil {
+			return err
+		}
+		end, err := strconv.ParseUint(strings.TrimSpace(last), 0, 32)
+		if err != nil {
+			return err
+		}
+		if end < start {
+			return fmt.Errorf("invalid range: %q", v)
+		}
+		*r = append(*r, d2xx.AddressRange{Start: uint32(start), End: uint32(end) + 1})
 	}
-
-	return w.Bytes(), nil
+	return nil
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// flashFlags are the flags of every command which talks to a target.
+type flashFlags struct {
+	pins      string
+	clock     hzFlag
+	clockAuto bool
+	timing    timingFlag
+	timeout   time.Duration
+	usb       d2xx.USBParams
+	trace     bool
+	traceFile string
+	traceLen  int
+	record    string
+	vcd       string
+	sim       string
+	noRecord  bool
+
+	recordFile *os.File      // -record
+	capture    *bytes.Buffer // the session, for -vcd
+}
+
+func (ff *flashFlags) register(fs *flag.FlagSet) {
+	var maps []string
+	for _, p := range d2xx.PinMaps() {
+		maps = append(maps, fmt.Sprintf("%s (%s)", p.Name, p.Desc))
+	}
+	fs.StringVar(&ff.pins, "pins", "", "wiring of the target: "+strings.Join(maps, ", ")+" (default: the adapter record's, else "+d2xx.PinsGPIO.Name+")")
+	fs.Var(&ff.clock, "clock", fmt.Sprintf("ICSPCLK frequency, e.g. 500k or 5M; -pins gpio times its high half only (default: the adapter record's, else %s)", hzFlagString(d2xx.DefaultClockHz)))
+	fs.BoolVar(&ff.noRecord, "no-adapter-record", false, "ignore the adapter record of the programmer EEPROM, see the adapter record command")
+	fs.BoolVar(&ff.clockAuto, "clock-auto", false, "halve -clock until the target answers with a supported device ID in time")
+	ff.usb = d2xx.DefaultUSBParams
+	fs.IntVar(&ff.usb.TransferSize, "usb-transfer", ff.usb.TransferSize, "USB IN transfer size in bytes, a multiple of 64 up to 65536")
+	fs.IntVar(&ff.usb.LatencyMS, "usb-latency", ff.usb.LatencyMS, "FT2232H latency timer in ms, 1 to 255")
+	fs.DurationVar(&ff.usb.Timeout, "usb-timeout", ff.usb.Timeout, "read and write timeout of the D2XX driver")
+	fs.BoolVar(&ff.usb.FlowControl, "usb-flow", ff.usb.FlowControl, "RTS/CTS flow control")
+	fs.DurationVar(&ff.timeout, "read-timeout", d2xx.DefaultReadTimeout, "fail when the FT2232H sends nothing for this long")
+	ff.registerAdapter(fs)
+	fs.StringVar(&ff.record, "record", "", "capture the bytes sent to and received from the MPSSE to the file, see the replay command")
+	fs.StringVar(&ff.vcd, "vcd", "", "write the ICSP waveforms of the session to the Value Change Dump file, see also the vcd command")
+	fs.Var(&ff.timing, "timing", "override a programming delay of the device: ENTH, ERAB, ERAR, PINT, PDFM or Margin, e.g. PINT=100us (repeatable)")
+}
+
+// registerAdapter registers the flags used by the commands which only talk to
+// the FT2232H.
+func (ff *flashFlags) registerAdapter(fs *flag.FlagSet) {
+	fs.BoolVar(&ff.trace, "trace", false, "log every D2XX call with its duration and payloads")
+	fs.StringVar(&ff.traceFile, "trace-file", "", "append the -trace log to the file instead of stderr")
+	fs.IntVar(&ff.traceLen, "trace-len", 32, "payload bytes hex dumped per call by -trace, 0 for all")
+	fs.StringVar(&ff.sim, "sim", "", "simulate the named device, e.g. PIC18F47Q43, instead of using an FT2232H")
+}
+
+// open opens the target as configured by the flags.
+func (ff *flashFlags) open() (*d2xx.Flash, error) {
+	var pins *d2xx.PinMap
+	if ff.pins != "" {
+		pins = d2xx.PinMapByName(ff.pins)
+		if pins == nil {
+			return nil, fmt.Errorf("unknown pin map: %s", ff.pins)
+		}
+	}
+	opts, err := ff.adapterOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Pins = pins
+	opts.ClockHz = int(ff.clock)
+	opts.IgnoreAdapterRecord = ff.noRecord
+	opts.AutoClock = ff.clockAuto
+	opts.Timing = d2xx.Timing(ff.timing)
+	opts.USB = &ff.usb
+	opts.ReadTimeout = ff.timeout
+
+	if ff.record != "" {
+		w, err := os.Create(ff.record)
+		if err != nil {
+			return nil, err
+		}
+		ff.recordFile = w
+		opts.Record = w
+	}
+	if ff.vcd != "" {
+		ff.capture = &bytes.Buffer{}
+		if opts.Record != nil {
+			opts.Record = io.MultiWriter(opts.Record, ff.capture)
+		} else {
+			opts.Record = ff.capture
+		}
+	}
+	flash, err := d2xx.OpenFlash(opts)
+	if err != nil {
+		// the capture of the failed attempt is kept
+		ff.closeRecord()
+		return nil, err
+	}
+	return flash, nil
+}
+
+// openAdapter opens the FT2232H alone as configured by the flags.
+func (ff *flashFlags) openAdapter() (*d2xx.Adapter, error) {
+	opts, err := ff.adapterOptions()
+	if err != nil {
+		return nil, err
+	}
+	return d2xx.OpenAdapter(opts)
+}
+
+// adapterOptions returns the options set by the flags of registerAdapter.
+func (ff *flashFlags) adapterOptions() (*d2xx.Options, error) {
+	opts := &d2xx.Options{TraceBytes: ff.traceLen}
+	if ff.sim != "" {
+		dev := d2xx.DeviceByName(ff.sim)
+		if dev == nil {
+			return nil, usageError("unknown device: " + ff.sim)
+		}
+		opts.Simulator = d2xx.NewSimulator(dev)
+	}
+
+	// the files are left open until exit: the handle logs its close too
+	if ff.trace || ff.traceFile != "" {
+		opts.Trace = os.Stderr
+		if ff.traceFile != "" {
+			w, err := os.OpenFile(ff.traceFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+			if err != nil {
+				return nil, err
+			}
+			opts.Trace = w
+		}
+	}
+	return opts, nil
+}
+
+// close closes flash, then the -record and -vcd files.
+func (ff *flashFlags) close(flash *d2xx.Flash) {
+	err := flash.Close()
+	if err != nil {
+		fail("d2xx", err)
+	}
+	if err := ff.closeRecord(); err != nil {
+		fail("record", err)
+	}
+	if ff.capture == nil {
+		return
+	}
+	records, err := d2xx.ReadCapture(ff.capture)
+	if err == nil {
+		err = writeVCD(ff.vcd, records)
+	}
+	if err != nil {
+		fail("vcd", err)
+	}
+}
+
+// closeRecord syncs and closes the -record file, if any.
+func (ff *flashFlags) closeRecord() error {
+	if ff.recordFile == nil {
+		return nil
+	}
+	err := ff.recordFile.Sync()
+	if err2 := ff.recordFile.Close(); err == nil {
+		err = err2
+	}
+	ff.recordFile = nil
+	return err
+}
+
+// timingFlag collects NAME=VALUE overrides of the programming delays.
+type timingFlag d2xx.Timing
+
+func (t *timingFlag) String() string {
+	var s []string
+	for _, kv := range strings.Fields((*d2xx.Timing)(t).String()) {
+		if !strings.HasSuffix(kv, "=0s") && kv != "Margin=0" {
+			s = append(s, kv)
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+func (t *timingFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid timing, NAME=VALUE expected: %s", s)
+	}
+	return (*d2xx.Timing)(t).Set(name, value)
+}
+
+// hzFlag is a frequency with an optional k or M suffix.
+type hzFlag int
+
+func (h *hzFlag) String() string {
+	return hzFlagString(int(*h))
+}
+
+func hzFlagString(hz int) string {
+	switch {
+	case hz >= 1_000_000 && hz%1_000_000 == 0:
+		return fmt.Sprintf("%dM", hz/1_000_000)
+	case hz >= 1_000 && hz%1_000 == 0:
+		return fmt.Sprintf("%dk", hz/1_000)
+	}
+	return strconv.Itoa(hz)
+}
+
+func (h *hzFlag) Set(s string) error {
+	num := strings.TrimSuffix(s, "Hz")
+	mul := 1.0
+	switch {
+	case strings.HasSuffix(num, "k"):
+		num, mul = num[:len(num)-1], 1e3
+	case strings.HasSuffix(num, "M"):
+		num, mul = num[:len(num)-1], 1e6
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return fmt.Errorf("invalid frequency: %s", s)
+	}
+	*h = hzFlag(v * mul)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// runReplay replays a capture taken with -record against the simulator, or
+// compares two captures.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var (
+		devName string
+		diff    bool
+	)
+	fs.StringVar(&devName, "d", "PIC18F47Q43", "device simulated")
+	fs.BoolVar(&diff, "diff", false, "compare two captures instead")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [-d DEVICE] CAPTURE\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s replay -diff CAPTURE CAPTURE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (!diff && fs.NArg() != 1) || (diff && fs.NArg() != 2) {
+		fs.Usage()
+		exitStatus = exitUsage
+		return
+	}
+
+	var captures [][]d2xx.CaptureRecord
+	for _, name := range fs.Args() {
+		records, err := readCapture(name)
+		if err != nil {
+			fail("replay", err)
+			return
+		}
+		captures = append(captures, records)
+	}
+
+	if diff {
+		err := d2xx.CompareCaptures(captures[0], captures[1])
+		if err != nil {
+			fail("replay", err)
+			return
+		}
+		fmt.Println("replay: same bytes written and read")
+		return
+	}
+
+	dev := d2xx.DeviceByName(devName)
+	if dev == nil {
+		fail("replay", usageError("unknown device: "+devName))
+		return
+	}
+	err := d2xx.Replay(captures[0], d2xx.NewSimulator(dev))
+	if err != nil {
+		fail("replay", err)
+		return
+	}
+	fmt.Printf("replay: %d transfers, the simulated %s answered as recorded\n", len(captures[0]), dev.Name)
+}
+
+func readCapture(name string) ([]d2xx.CaptureRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return d2xx.ReadCapture(f)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// stdout receives the human readable output. It is discarded in JSON mode.
+var stdout io.Writer = os.Stdout
+
+// report is the machine readable summary of a whole run.
+type report struct {
+	Library    string                `json:"library"`
+	Writer     *writerInfo           `json:"writer,omitempty"`
+	Target     *targetInfo           `json:"target,omitempty"`
+	Image      *imageInfo            `json:"image,omitempty"`
+	Serial     *serialAssignment     `json:"serial,omitempty"`
+	Checksums  map[string]*checksums `json:"checksums,omitempty"`
+	Operations []*opReport           `json:"operations"`
+	Result     string                `json:"result"`
+	Error      string                `json:"error,omitempty"`
+	ExitCode   int                   `json:"exitCode"`
+}
+
+type writerInfo struct {
+	DevType   string `json:"devType"`
+	DevTypeID uint32 `json:"devTypeID"`
+	VendorID  uint16 `json:"vendorID"`
+	DeviceID  uint16 `json:"deviceID"`
+	Serial    string `json:"serial"`
+	ClockHz   int    `json:"clockHz"`
+	USB       string `json:"usb"`
+	Adapter   string `json:"adapter,omitempty"`
+}
+
+type targetInfo struct {
+	Name          string         `json:"name"`
+	DeviceID      uint16         `json:"deviceID"`
+	RevisionID    uint16         `json:"revisionID"`
+	Revision      string         `json:"revision"`
+	UniqueID      string         `json:"uniqueID"`
+	UserIDs       []uint16       `json:"userIDs"`
+	Configuration string         `json:"configuration"`
+	Config        []configReport `json:"config"`
+	Timing        string         `json:"timing"`
+	Warnings      []string       `json:"warnings,omitempty"`
+}
+
+type configReport struct {
+	Register string `json:"register"`
+	Field    string `json:"field"`
+	Value    byte   `json:"value"`
+	Symbol   string `json:"symbol"`
+}
+
+type imageInfo struct {
+	Files    []string `json:"files"`
+	Segments []string `json:"segments"`
+}
+
+type opReport struct {
+	Op       string  `json:"op"`
+	File     string  `json:"file,omitempty"`
+	Bytes    int64   `json:"bytes,omitempty"`
+	Duration float64 `json:"durationSec"`
+	Result   string  `json:"result"`
+	Error    string  `json:"error,omitempty"`
+
+	start time.Time
+}
+
+func newReport() *report {
+	verMajor, verMinor, verPatch := d2xx.Version()
+	return &report{
+		Library:    fmt.Sprintf("%d.%d.%d", verMajor, verMinor, verPatch),
+		Checksums:  map[string]*checksums{},
+		Operations: []*opReport{},
+		Result:     "ok",
+	}
+}
+
+// fail records err as the result of the run and prints it to stderr.
+// Only the first failure is kept, as the error and the exit code.
+func (r *report) fail(prefix string, err error) {
+	fail(prefix, err)
+	r.Result = "error"
+	if r.Error == "" {
+		r.Error = prefix + ": " + err.Error()
+	}
+	r.ExitCode = exitStatus
+}
+
+// begin starts timing an operation.
+func (r *report) begin(op, file string) *opReport {
+	o := &opReport{Op: op, File: file, start: time.Now()}
+	r.Operations = append(r.Operations, o)
+	return o
+}
+
+// end records the outcome of the operation.
+func (r *report) end(o *opReport, n int64, err error) {
+	o.Duration = time.Since(o.start).Seconds()
+	o.Bytes = n
+	if err != nil {
+		o.Result = "error"
+		o.Error = err.Error()
+		r.fail(o.Op, err)
+		return
+	}
+	o.Result = "ok"
+}
+
+func (r *report) setWriter(flash *d2xx.Flash) {
+	devType, venID, devID := flash.WriterInfo()
+	r.Writer = &writerInfo{
+		DevType:   devType.String(),
+		DevTypeID: uint32(devType),
+		VendorID:  venID,
+		DeviceID:  devID,
+		Serial:    flash.WriterSerial(),
+		ClockHz:   flash.ClockHz(),
+		USB:       flash.USB().String(),
+	}
+	if rec := flash.AdapterRecord(); rec != nil {
+		r.Writer.Adapter = rec.String()
+	}
+}
+
+func (r *report) setTarget(flash *d2xx.Flash) {
+	t := &targetInfo{
+		Name:          flash.Device.Name,
+		DeviceID:      flash.DeviceID,
+		RevisionID:    flash.RevisionID,
+		Revision:      fmt.Sprintf("%s%d", flash.RevisionMajor, flash.RevisionMinor),
+		UniqueID:      flash.DIA.UniqueID(),
+		Configuration: fmt.Sprintf("% x", flash.Configuration[:]),
+		Timing:        flash.Timing().String(),
+	}
+	for _, value16 := range flash.UserIDs {
+		t.UserIDs = append(t.UserIDs, uint16(value16[0])|(uint16(value16[1])<<8))
+	}
+	for _, s := range flash.Device.DecodeConfig(flash.Configuration[:]) {
+		t.Config = append(t.Config, configReport{
+			Register: fmt.Sprintf("CONFIG%d", s.Field.Reg+1),
+			Field:    s.Field.Name,
+			Value:    s.Value,
+			Symbol:   s.Symbol(),
+		})
+	}
+	if err := flash.DCI.Check(flash.Device); err != nil {
+		t.Warnings = append(t.Warnings, err.Error())
+	}
+	r.Target = t
+}
+
+func (r *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
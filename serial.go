@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ysh86/ftPIC/firmware"
+)
+
+// serializer hands out a unique serial number per programmed device.
+//
+// Every attempt is appended to a JSON-lines state file. A serial is claimed
+// when assigned, and consumed once reserved, by a record synced just before
+// the target is programmed: whatever happens next, even a crash, it is never
+// handed out again. Attempts which failed before programming release it for
+// the next device. The state file is locked and read again by each of these
+// steps only, so concurrent runs on several programmers get distinct serials
+// without waiting for each other's programming.
+type serializer struct {
+	stateFile string
+	format    string
+	addr      uint32
+	sqtp      []sqtpEntry
+	start     int // index of the first serial
+}
+
+// serialRecord is a line of the state file.
+type serialRecord struct {
+	Time     time.Time `json:"time"`
+	Index    int       `json:"index"`
+	Serial   string    `json:"serial"`
+	Address  uint32    `json:"address"`
+	UniqueID string    `json:"uniqueID"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// serialAssignment is the serial patched into the image for this device.
+type serialAssignment struct {
+	Index   int    `json:"index"`
+	Serial  string `json:"serial"`
+	Address uint32 `json:"address"`
+	data    []byte
+}
+
+// sqtpEntry is one serial of an SQTP file.
+type sqtpEntry struct {
+	addr uint32
+	data []byte
+}
+
+func newSerializer(opts *options) (*serializer, error) {
+	if opts.serialState == "" {
+		return nil, errors.New("-serial-state is required")
+	}
+	s := &serializer{
+		stateFile: opts.serialState,
+		format:    opts.serialFormat,
+		addr:      uint32(opts.serialAddr),
+		start:     int(opts.serialStart),
+	}
+	if opts.sqtpFile != "" {
+		entries, err := loadSQTP(opts.sqtpFile)
+		if err != nil {
+			return nil, err
+		}
+		s.sqtp = entries
+		s.start = 0
+	}
+
+	// fail early on a broken state file
+	err := s.locked(func(f *os.File) error {
+		_, err := s.claimed(f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// locked runs fn with the state file open and locked.
+func (s *serializer) locked(fn func(f *os.File) error) error {
+	f, err := os.OpenFile(s.stateFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("%s: lock: %w", s.stateFile, err)
+	}
+	return fn(f)
+}
+
+// claimed reads the state file and returns the serials which can't be
+// assigned: consumed, or claimed by a run still in progress.
+func (s *serializer) claimed(f *os.File) (map[int]bool, error) {
+	consumed := make(map[int]bool)
+	claimed := make(map[int]bool)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		var r serialRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", s.stateFile, line, err)
+		}
+		switch r.Result {
+		case "ok", "reserved":
+			consumed[r.Index] = true
+			claimed[r.Index] = true
+		case "assigned":
+			claimed[r.Index] = true
+		case "error":
+			claimed[r.Index] = consumed[r.Index]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// assign claims the first serial available and patches it into the image.
+func (s *serializer) assign(img *firmware.Image, uniqueID string) (*serialAssignment, error) {
+	var a *serialAssignment
+	err := s.locked(func(f *os.File) error {
+		claimed, err := s.claimed(f)
+		if err != nil {
+			return err
+		}
+		next := s.start
+		for claimed[next] {
+			next++
+		}
+
+		a = &serialAssignment{Index: next}
+		if s.sqtp != nil {
+			if next >= len(s.sqtp) {
+				return fmt.Errorf("all %d serials of the SQTP file are used", len(s.sqtp))
+			}
+			e := s.sqtp[next]
+			a.Address = e.addr
+			a.data = e.data
+			a.Serial = strings.ToUpper(hex.EncodeToString(e.data))
+		} else {
+			a.Address = s.addr
+			a.Serial = fmt.Sprintf(s.format, next)
+			a.data = []byte(a.Serial)
+		}
+		return s.append(f, a, uniqueID, "assigned", "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	img.Set(a.Address, a.data)
+	return a, nil
+}
+
+// reserve consumes the assigned serial before it is programmed.
+func (s *serializer) reserve(a *serialAssignment, uniqueID string) error {
+	return s.locked(func(f *os.File) error {
+		return s.append(f, a, uniqueID, "reserved", "")
+	})
+}
+
+// record appends the outcome of programming the assigned serial.
+func (s *serializer) record(a *serialAssignment, uniqueID string, written bool, errMsg string) error {
+	result := "ok"
+	if !written {
+		result = "error"
+	}
+	return s.locked(func(f *os.File) error {
+		return s.append(f, a, uniqueID, result, errMsg)
+	})
+}
+
+func (s *serializer) append(f *os.File, a *serialAssignment, uniqueID, result, errMsg string) error {
+	r := serialRecord{
+		Time:     time.Now(),
+		Index:    a.Index,
+		Serial:   a.Serial,
+		Address:  a.Address,
+		UniqueID: uniqueID,
+		Result:   result,
+		Error:    errMsg,
+	}
+	b, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	return err
+}
+
+// loadSQTP reads a Microchip SQTP file: an Intel HEX file where each data
+// record holds the serial of one device.
+func loadSQTP(file string) ([]sqtpEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []sqtpEntry
+	upper := uint32(0)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if text[0] != ':' {
+			return nil, fmt.Errorf("%s:%d: invalid record", file, line)
+		}
+		b, err := hex.DecodeString(text[1:])
+		if err != nil || len(b) < 5 || int(b[0]) != len(b)-5 {
+			return nil, fmt.Errorf("%s:%d: invalid record", file, line)
+		}
+		sum := byte(0)
+		for _, v := range b {
+			sum += v
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("%s:%d: invalid checksum", file, line)
+		}
+		data := b[4 : len(b)-1]
+		switch b[3] {
+		case 0x00:
+			addr := upper | uint32(b[1])<<8 | uint32(b[2])
+			entries = append(entries, sqtpEntry{addr: addr, data: data})
+		case 0x01:
+			// EOF
+		case 0x04:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%s:%d: invalid record", file, line)
+			}
+			upper = uint32(data[0])<<24 | uint32(data[1])<<16
+		default:
+			return nil, fmt.Errorf("%s:%d: unsupported record type %s", file, line, fmt.Sprint(b[3]))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no serial", file)
+	}
+	return entries, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ysh86/ftPIC/d2xx"
+)
+
+// runVCD converts a capture taken with -record to a Value Change Dump.
+func runVCD(args []string) {
+	fs := flag.NewFlagSet("vcd", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s vcd CAPTURE OUT.vcd\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		exitStatus = exitUsage
+		return
+	}
+
+	records, err := readCapture(fs.Arg(0))
+	if err == nil {
+		err = writeVCD(fs.Arg(1), records)
+	}
+	if err != nil {
+		fail("vcd", err)
+	}
+}
+
+func writeVCD(name string, records []d2xx.CaptureRecord) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = d2xx.WriteVCD(f, records)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}